@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/rawen554/go-loyal/internal/adapters/accrual/fake"
+	"github.com/rawen554/go-loyal/internal/logger"
+)
+
+const (
+	timeoutServerShutdown = time.Second * 5
+	readHeaderTimeout     = time.Second * 5
+)
+
+type config struct {
+	RunAddr string `env:"RUN_ADDRESS" envDefault:":8081"`
+	Rules   string `env:"ACCRUAL_FAKE_RULES" envDefault:":PROCESSED:500:10s"`
+	RPM     int    `env:"ACCRUAL_FAKE_RPM" envDefault:"0"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancelCtx()
+
+	logger, err := logger.NewLogger()
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	var cfg config
+	if err := env.Parse(&cfg); err != nil {
+		return fmt.Errorf("error parsing env variables: %w", err)
+	}
+	flag.StringVar(&cfg.RunAddr, "a", cfg.RunAddr, "address and port to run server")
+	flag.StringVar(&cfg.Rules, "rules", cfg.Rules, "prefix:outcome[:accrual[:delay]],...")
+	flag.IntVar(&cfg.RPM, "rpm", cfg.RPM, "requests per minute before 429, 0 means no limit")
+	flag.Parse()
+
+	rules, err := fake.ParseRules(cfg.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.RunAddr,
+		Handler:           fake.NewServer(fake.Config{Rules: rules, RPM: cfg.RPM}).Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownTimeoutCtx, cancelShutdownTimeoutCtx := context.WithTimeout(context.Background(), timeoutServerShutdown)
+		defer cancelShutdownTimeoutCtx()
+		if err := srv.Shutdown(shutdownTimeoutCtx); err != nil {
+			logger.Errorf("an error occurred during server shutdown: %v", err)
+		}
+	}()
+
+	logger.Infof("fake accrual is listening on %v with rules %q", cfg.RunAddr, cfg.Rules)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("run server has failed: %w", err)
+	}
+	return nil
+}
@@ -12,17 +12,22 @@ import (
 	"time"
 
 	"github.com/rawen554/go-loyal/internal/adapters/accrual"
+	"github.com/rawen554/go-loyal/internal/adapters/notifier"
 	"github.com/rawen554/go-loyal/internal/adapters/store"
 	"github.com/rawen554/go-loyal/internal/app"
 	"github.com/rawen554/go-loyal/internal/config"
+	"github.com/rawen554/go-loyal/internal/expiration"
 	"github.com/rawen554/go-loyal/internal/logger"
 	"github.com/rawen554/go-loyal/internal/processing"
+	"go.uber.org/zap"
 )
 
 const (
-	timeoutServerShutdown = time.Second * 5
-	timeoutShutdown       = time.Second * 10
-	component             = "component"
+	timeoutServerShutdown     = time.Second * 5
+	timeoutProcessingShutdown = time.Second * 5
+	timeoutShutdown           = time.Second * 10
+	component                 = "component"
+	defaultAccrualBackend     = "default"
 )
 
 func main() {
@@ -45,7 +50,30 @@ func run() error {
 		return fmt.Errorf("failed to parse config: %w", err)
 	}
 
-	storage, err := store.NewStore(ctx, config.DatabaseURI, config.LogLevel)
+	storage, err := store.NewStore(ctx, config.DatabaseURI, config.LogLevel,
+		store.WithPointsPolicy(store.PointsPolicy{
+			LifetimeMonths:     config.PointsLifetimeMonths,
+			ExpiringSoonWindow: config.PointsExpiringSoon,
+		}),
+		store.WithTierPolicy(store.TierPolicy{
+			Tiers:  config.Tiers,
+			Window: config.LoyaltyTierWindow,
+		}),
+		store.WithTransferPolicy(store.TransferPolicy{
+			DailySum:   config.TransferDailySum,
+			DailyCount: config.TransferDailyCount,
+		}),
+		store.WithReferralPolicy(store.ReferralPolicy{
+			Bonus: config.ReferralBonus,
+		}),
+		store.WithWithdrawPolicy(store.WithdrawPolicy{
+			MinSum:      config.WithdrawMinSum,
+			MaxSum:      config.WithdrawMaxSum,
+			DailySum:    config.WithdrawDailySum,
+			MonthlySum:  config.WithdrawMonthlySum,
+			HourlyCount: config.WithdrawHourlyCount,
+		}),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
@@ -55,18 +83,42 @@ func run() error {
 		wg.Wait()
 	}()
 
-	wg.Add(1)
-	go func() {
-		defer logger.Info("closed DB")
-		defer wg.Done()
-		<-ctx.Done()
+	componentsErrs := make(chan error, 1)
 
-		storage.Close()
-	}()
+	resetNotifier, err := notifier.NewNotifier(
+		config.ResetNotifier,
+		config.ResetNotifierFile,
+		logger.With(component, "notifier"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create notifier: %w", err)
+	}
 
-	componentsErrs := make(chan error, 1)
+	accrualClient, accrualHealth, err := newAccrual(config, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create accrual client: %w", err)
+	}
+
+	processingInstance := processing.NewProcessingController(
+		storage,
+		accrualClient,
+		logger.With(component, "processing-controller"),
+		processing.WithUnknownOrderPolicy(processing.UnknownOrderPolicy{
+			Window:     config.UnknownOrderWindow,
+			Backoff:    config.UnknownOrderBackoff,
+			MaxBackoff: config.UnknownOrderMaxBackoff,
+		}),
+		processing.WithBatchSize(config.AccrualBatchSize),
+	)
 
-	app := app.NewApp(config, storage, logger.With(component, "app"))
+	app, err := app.NewApp(config, storage, logger.With(component, "app"),
+		app.WithNotifier(resetNotifier),
+		accrualHealth,
+		app.WithAccrualIngester(processingInstance),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create app: %w", err)
+	}
 	srv, err := app.NewServer()
 	if err != nil {
 		logger.Fatalf("error creating server: %w", err)
@@ -81,20 +133,49 @@ func run() error {
 		}
 	}(componentsErrs)
 
-	accrual, err := accrual.NewAccrualClient(config.AccrualAddr, logger.With(component, "accrual-client"))
-	if err != nil {
-		return fmt.Errorf("failed to create accrual client: %w", err)
-	}
+	// Processing outlives ctx so that Shutdown can finish the order in flight.
+	processingCtx, cancelProcessingCtx := context.WithCancel(context.Background())
+	defer cancelProcessingCtx()
+	processingInstance.Process(processingCtx)
 
-	processingInstance := processing.NewProcessingController(
+	processingStopped := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer logger.Info("processing has been stopped")
+		defer wg.Done()
+		defer close(processingStopped)
+		<-ctx.Done()
+
+		shutdownTimeoutCtx, cancelShutdownTimeoutCtx := context.WithTimeout(context.Background(), timeoutProcessingShutdown)
+		defer cancelShutdownTimeoutCtx()
+		if err := processingInstance.Shutdown(shutdownTimeoutCtx); err != nil {
+			logger.Errorf("an error occurred during processing shutdown: %v", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer logger.Info("closed DB")
+		defer wg.Done()
+		<-ctx.Done()
+		<-processingStopped
+
+		storage.Close()
+	}()
+
+	expirer := expiration.NewExpirer(
 		storage,
-		accrual,
-		logger.With(component, "processing-controller"),
+		config.PointsExpirationInterval,
+		logger.With(component, "points-expirer"),
 	)
 
-	go func(ctx context.Context) {
-		processingInstance.Process(ctx)
-	}(ctx)
+	wg.Add(1)
+	go func() {
+		defer logger.Info("points expirer has been stopped")
+		defer wg.Done()
+
+		expirer.Run(ctx)
+	}()
 
 	wg.Add(1)
 	go func() {
@@ -126,3 +207,106 @@ func run() error {
 
 	return nil
 }
+
+// newAccrual returns the client of ACCRUAL_SYSTEM_ADDRESS, or a router over ACCRUAL_BACKENDS
+// falling back to ACCRUAL_SYSTEM_ADDRESS for orders no backend serves, together with the option
+// reporting its circuit breakers in /health. Every routed backend has a breaker of its own.
+// All clients share the timeout and proxy settings, routed backends may override TLS files and headers.
+func newAccrual(cfg *config.ServerConfig, logger *zap.SugaredLogger) (accrual.Accrual, app.Option, error) {
+	defaultTLS := accrual.TLSFiles{
+		CertFile: cfg.AccrualTLSCertFile,
+		KeyFile:  cfg.AccrualTLSKeyFile,
+		CAFile:   cfg.AccrualTLSCAFile,
+	}
+	newBreaker := func() *accrual.Breaker {
+		return accrual.NewBreaker(accrual.BreakerConfig{
+			Failures:          cfg.AccrualBreakerFailures,
+			OpenTimeout:       cfg.AccrualBreakerOpenTimeout,
+			HalfOpenSuccesses: cfg.AccrualBreakerHalfOpenSuccesses,
+		})
+	}
+	newClient := func(
+		addr string,
+		rpm int,
+		batch bool,
+		files accrual.TLSFiles,
+		headers http.Header,
+		logger *zap.SugaredLogger,
+	) (accrual.Accrual, error) {
+		tlsConfig, err := accrual.LoadTLSConfig(files)
+		if err != nil {
+			return nil, fmt.Errorf("error loading accrual TLS config: %w", err)
+		}
+		//nolint:wrapcheck // the caller wraps it
+		return accrual.NewAccrualClient(addr, logger,
+			accrual.WithRateLimit(rpm),
+			accrual.WithBatchLookups(batch),
+			accrual.WithTLSConfig(tlsConfig),
+			accrual.WithTimeout(cfg.AccrualTimeout),
+			accrual.WithHeaders(headers),
+			accrual.WithProxy(cfg.AccrualProxyURL),
+		)
+	}
+
+	if len(cfg.AccrualBackends) == 0 {
+		client, err := newClient(cfg.AccrualAddr, cfg.AccrualRPM, cfg.AccrualBatch, defaultTLS, cfg.AccrualHeaders,
+			logger.With(component, "accrual-client"))
+		if err != nil {
+			return nil, nil, err
+		}
+		breaker := newBreaker()
+		return accrual.WithBreaker(client, breaker), app.WithAccrualBreaker(breaker), nil
+	}
+
+	backends := make([]accrual.Backend, 0, len(cfg.AccrualBackends)+1)
+	for _, b := range cfg.AccrualBackends {
+		files := defaultTLS
+		if b.TLSCertFile != "" {
+			files.CertFile, files.KeyFile = b.TLSCertFile, b.TLSKeyFile
+		}
+		if b.TLSCAFile != "" {
+			files.CAFile = b.TLSCAFile
+		}
+		headers := cfg.AccrualHeaders.Clone()
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		for name, values := range b.Header {
+			headers[name] = values
+		}
+
+		client, err := newClient(b.Address, b.RPM, b.Batch, files, headers,
+			logger.With(component, "accrual-client", "backend", b.Name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating accrual client %v: %w", b.Name, err)
+		}
+
+		ranges := make([]accrual.Range, 0, len(b.Ranges))
+		for _, r := range b.Ranges {
+			accrualRange, err := accrual.NewRange(r.From, r.To)
+			if err != nil {
+				return nil, nil, fmt.Errorf("malformed range of accrual backend %v: %w", b.Name, err)
+			}
+			ranges = append(ranges, accrualRange)
+		}
+		backends = append(backends, accrual.Backend{
+			Name:     b.Name,
+			Client:   client,
+			Breaker:  newBreaker(),
+			Prefixes: b.Prefixes,
+			Ranges:   ranges,
+		})
+	}
+
+	if cfg.AccrualAddr != "" {
+		client, err := newClient(cfg.AccrualAddr, cfg.AccrualRPM, cfg.AccrualBatch, defaultTLS, cfg.AccrualHeaders,
+			logger.With(component, "accrual-client", "backend", defaultAccrualBackend))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating default accrual client: %w", err)
+		}
+		backends = append(backends, accrual.Backend{Name: defaultAccrualBackend, Client: client, Breaker: newBreaker()})
+	}
+
+	router := accrual.NewRouter(backends...)
+	return router, app.WithAccrualBackendBreakers(router), nil
+}
@@ -19,13 +19,22 @@ import (
 
 const OrdersAPI = "/api/orders/"
 
+// OrdersBatchAPI looks up many orders in one request, see WithBatchLookups.
+const OrdersBatchAPI = "/api/orders/batch"
+
+// DefaultCoolDown is used when a 429 response has no usable Retry-After.
+const DefaultCoolDown = time.Minute
+
 var ErrNoOrder = errors.New("order is not processed")
 var ErrServiceBusy = errors.New("accrual is busy")
+var ErrNoRetryAfter = errors.New("no valid Retry-After header")
 
 var NumberRegExp = regexp.MustCompile(`(\d+)`)
 
 type ServiceBusyError struct {
-	Err      error
+	Err error
+	// Backend names the busy backend when lookups are routed to several ones, see Router.
+	Backend  string
 	CoolDown time.Duration
 	MaxRPM   int
 }
@@ -34,6 +43,10 @@ func (sbe *ServiceBusyError) Error() string {
 	return fmt.Sprintf("wait: %vs; max rpm: %v; %v", sbe.CoolDown.Seconds(), sbe.MaxRPM, sbe.Err)
 }
 
+func (sbe *ServiceBusyError) Unwrap() error {
+	return sbe.Err
+}
+
 func NewServiceBusyError(cooldown time.Duration, rpm int, err error) error {
 	return &ServiceBusyError{
 		CoolDown: cooldown,
@@ -42,14 +55,100 @@ func NewServiceBusyError(cooldown time.Duration, rpm int, err error) error {
 	}
 }
 
+// ServerError is returned on 5xx responses, the request may succeed later.
+type ServerError struct {
+	Body       string
+	StatusCode int
+}
+
+func (se *ServerError) Error() string {
+	return fmt.Sprintf("accrual server error: status %v: %v", se.StatusCode, se.Body)
+}
+
+// ClientError is returned on 4xx responses other than 429.
+type ClientError struct {
+	Body       string
+	StatusCode int
+}
+
+func (ce *ClientError) Error() string {
+	return fmt.Sprintf("accrual rejected request: status %v: %v", ce.StatusCode, ce.Body)
+}
+
+// OrderRejected reports whether accrual rejected the order number itself rather than the client
+// (authentication, wrong address and so on), so the order will never be accepted.
+func (ce *ClientError) OrderRejected() bool {
+	return ce.StatusCode == http.StatusBadRequest || ce.StatusCode == http.StatusUnprocessableEntity
+}
+
+// BatchError is returned by a batch lookup that failed for some of the orders only, the infos of the other
+// orders are returned along with it. Errs holds the error of every failed order by its number.
+type BatchError struct {
+	Errs map[string]error
+}
+
+func (be *BatchError) Error() string {
+	return fmt.Sprintf("lookup of %v orders failed", len(be.Errs))
+}
+
+// MalformedResponseError is returned when a response does not follow the accrual API.
+type MalformedResponseError struct {
+	Err        error
+	Body       string
+	StatusCode int
+}
+
+func (mre *MalformedResponseError) Error() string {
+	return fmt.Sprintf("malformed accrual response: status %v: %v", mre.StatusCode, mre.Err)
+}
+
+func (mre *MalformedResponseError) Unwrap() error {
+	return mre.Err
+}
+
 type AccrualClient struct {
 	client      *retryablehttp.Client
 	logger      *zap.SugaredLogger
+	limiter     *limiter
+	headers     http.Header
 	accrualAddr string
+	batch       bool
+}
+
+// batchAccrualClient is an AccrualClient of a provider serving OrdersBatchAPI.
+type batchAccrualClient struct {
+	*AccrualClient
+}
+
+type ClientOption func(*AccrualClient)
+
+// WithRateLimit makes the client send no more than rpm requests per minute, waiting for a slot
+// instead of running into 429. Zero means no limit.
+func WithRateLimit(rpm int) ClientOption {
+	return func(a *AccrualClient) {
+		if rpm > 0 {
+			a.limiter = newLimiter(rpm)
+		}
+	}
+}
+
+// WithBatchLookups makes the client implement BatchAccrual through OrdersBatchAPI.
+// Only enable it for providers that serve the endpoint.
+func WithBatchLookups(enabled bool) ClientOption {
+	return func(a *AccrualClient) {
+		a.batch = enabled
+	}
 }
 
 type Accrual interface {
-	GetOrderInfo(num string) (*AccrualOrderInfoShema, error)
+	GetOrderInfo(ctx context.Context, num string) (*AccrualOrderInfoShema, error)
+}
+
+// BatchAccrual is implemented by providers that can look up many orders in one request.
+// Orders missing from the result are unknown to the provider, like ErrNoOrder for a single lookup.
+type BatchAccrual interface {
+	Accrual
+	GetOrdersInfo(ctx context.Context, nums []string) (map[string]*AccrualOrderInfoShema, error)
 }
 
 type AccrualOrderInfoShema struct {
@@ -58,76 +157,236 @@ type AccrualOrderInfoShema struct {
 	Accrual float64       `json:"accrual,omitempty"`
 }
 
-func NewAccrualClient(accrualAddr string, logger *zap.SugaredLogger) (Accrual, error) {
+func NewAccrualClient(accrualAddr string, logger *zap.SugaredLogger, opts ...ClientOption) (Accrual, error) {
 	client := retryablehttp.NewClient()
 	client.RetryMax = 3
 	client.CheckRetry = checkRetry
 	client.Backoff = backoff
+	// Hand the last response back once retries are exhausted so that its status can be reported.
+	client.ErrorHandler = retryablehttp.PassthroughErrorHandler
 
-	return &AccrualClient{
+	a := &AccrualClient{
 		accrualAddr: accrualAddr,
 		client:      client,
 		logger:      logger,
-	}, nil
+		headers:     make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.batch {
+		return &batchAccrualClient{AccrualClient: a}, nil
+	}
+	return a, nil
 }
 
-func (a *AccrualClient) GetOrderInfo(num string) (*AccrualOrderInfoShema, error) {
+func (a *AccrualClient) GetOrderInfo(ctx context.Context, num string) (*AccrualOrderInfoShema, error) {
 	url, err := url.JoinPath(a.accrualAddr, OrdersAPI, num)
 	if err != nil {
 		return nil, fmt.Errorf("error joining path: %w", err)
 	}
 
-	req, err := retryablehttp.NewRequest(http.MethodGet, url, nil)
+	result, res, err := a.do(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error building request: %w", err)
+		return nil, err
 	}
 
-	result, err := a.client.Do(req)
+	switch result.StatusCode {
+	case http.StatusOK:
+		return parseOrderInfo(num, res)
+	case http.StatusNoContent:
+		return nil, ErrNoOrder
+	default:
+		return nil, responseError(result, res)
+	}
+}
+
+// GetOrdersInfo posts the numbers to OrdersBatchAPI as a JSON array, the provider answers with an array
+// of the orders it knows, in the format of a single lookup.
+func (ba *batchAccrualClient) GetOrdersInfo(
+	ctx context.Context,
+	nums []string,
+) (map[string]*AccrualOrderInfoShema, error) {
+	url, err := url.JoinPath(ba.accrualAddr, OrdersBatchAPI)
+	if err != nil {
+		return nil, fmt.Errorf("error joining path: %w", err)
+	}
+	body, err := json.Marshal(nums)
 	if err != nil {
-		return nil, fmt.Errorf("error getting order info from accrual: %w", err)
+		return nil, fmt.Errorf("error encoding order numbers: %w", err)
 	}
 
-	res, err := io.ReadAll(result.Body)
+	result, res, err := ba.do(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch result.StatusCode {
+	case http.StatusOK:
+		return parseOrdersInfo(nums, res)
+	case http.StatusNoContent:
+		return make(map[string]*AccrualOrderInfoShema), nil
+	default:
+		return nil, responseError(result, res)
+	}
+}
+
+// do sends a request with the configured headers once the rate limit allows it and reads the response body.
+func (a *AccrualClient) do(ctx context.Context, method, url string, body []byte) (*http.Response, []byte, error) {
+	var rawBody interface{}
+	if body != nil {
+		rawBody = body
+	}
+	req, err := retryablehttp.NewRequestWithContext(ctx, method, url, rawBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building request: %w", err)
+	}
+	for name, values := range a.headers {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if a.limiter != nil {
+		if err := a.limiter.wait(ctx); err != nil {
+			return nil, nil, fmt.Errorf("error waiting for rate limit: %w", err)
+		}
+	}
+
+	result, err := a.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting order info from accrual: %w", err)
+	}
 
 	defer func() {
 		if err := result.Body.Close(); err != nil {
-			a.logger.Errorf("error close body: %w", err)
+			a.logger.Errorf("error close body: %v", err)
 		}
 	}()
 
-	switch result.StatusCode {
-	case http.StatusOK:
-		var orderInfo AccrualOrderInfoShema
+	res, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading accrual response: %w", err)
+	}
+
+	return result, res, nil
+}
 
-		if err := json.Unmarshal(res, &orderInfo); err != nil {
-			return nil, fmt.Errorf("error parsing json: %w", err)
+// responseError describes a response that carries no order info.
+func responseError(result *http.Response, res []byte) error {
+	switch {
+	case result.StatusCode == http.StatusTooManyRequests:
+		rpm := 0
+		if found := NumberRegExp.Find(res); found != nil {
+			rpm, _ = strconv.Atoi(string(found))
 		}
 
-		return &orderInfo, nil
-	case http.StatusNoContent:
-		return nil, ErrNoOrder
-	case http.StatusTooManyRequests:
-		cooldown, err := strconv.Atoi(result.Header.Get("Retry-After"))
+		cooldown, err := parseRetryAfter(result.Header.Get("Retry-After"), time.Now())
 		if err != nil {
-			return nil, fmt.Errorf("error converting header Retry-After: %w", err)
+			return NewServiceBusyError(DefaultCoolDown, rpm, err)
+		}
+
+		return NewServiceBusyError(cooldown, rpm, ErrServiceBusy)
+	case result.StatusCode >= http.StatusInternalServerError:
+		return &ServerError{StatusCode: result.StatusCode, Body: string(res)}
+	case result.StatusCode >= http.StatusBadRequest:
+		return &ClientError{StatusCode: result.StatusCode, Body: string(res)}
+	default:
+		return &MalformedResponseError{
+			StatusCode: result.StatusCode,
+			Body:       string(res),
+			Err:        errors.New("unexpected status"),
 		}
+	}
+}
 
-		rpm := NumberRegExp.Find(res)
-		if rpm == nil {
-			return nil, fmt.Errorf("not found MaxRPM in body: %w", err)
+func parseOrderInfo(num string, body []byte) (*AccrualOrderInfoShema, error) {
+	var orderInfo AccrualOrderInfoShema
+	if err := json.Unmarshal(body, &orderInfo); err != nil {
+		return nil, &MalformedResponseError{StatusCode: http.StatusOK, Body: string(body), Err: err}
+	}
+
+	switch {
+	case orderInfo.Order != num:
+		return nil, &MalformedResponseError{
+			StatusCode: http.StatusOK,
+			Body:       string(body),
+			Err:        fmt.Errorf("got order %q instead of %q", orderInfo.Order, num),
 		}
-		preparedRPM, err := strconv.Atoi(string(rpm))
-		if err != nil {
-			return nil, fmt.Errorf("cant convert MaxRPM to int: %w", err)
+	case !orderInfo.Status.IsAccrualStatus():
+		return nil, &MalformedResponseError{
+			StatusCode: http.StatusOK,
+			Body:       string(body),
+			Err:        fmt.Errorf("unknown status %q", orderInfo.Status),
 		}
+	}
 
-		return nil, NewServiceBusyError(time.Duration(cooldown)*time.Second, preparedRPM, err)
-	default:
-		return nil, fmt.Errorf("unknown exception: %w", err)
+	return &orderInfo, nil
+}
+
+func parseOrdersInfo(nums []string, body []byte) (map[string]*AccrualOrderInfoShema, error) {
+	var ordersInfo []AccrualOrderInfoShema
+	if err := json.Unmarshal(body, &ordersInfo); err != nil {
+		return nil, &MalformedResponseError{StatusCode: http.StatusOK, Body: string(body), Err: err}
+	}
+
+	requested := make(map[string]bool, len(nums))
+	for _, num := range nums {
+		requested[num] = true
+	}
+
+	infos := make(map[string]*AccrualOrderInfoShema, len(ordersInfo))
+	for i := range ordersInfo {
+		info := &ordersInfo[i]
+		switch {
+		case !requested[info.Order]:
+			return nil, &MalformedResponseError{
+				StatusCode: http.StatusOK,
+				Body:       string(body),
+				Err:        fmt.Errorf("got order %q that was not requested", info.Order),
+			}
+		case !info.Status.IsAccrualStatus():
+			return nil, &MalformedResponseError{
+				StatusCode: http.StatusOK,
+				Body:       string(body),
+				Err:        fmt.Errorf("unknown status %q of order %q", info.Status, info.Order),
+			}
+		}
+		infos[info.Order] = info
+	}
+
+	return infos, nil
+}
+
+// parseRetryAfter accepts both forms of Retry-After: delay in seconds and HTTP-date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, error) {
+	if value == "" {
+		return 0, ErrNoRetryAfter
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("negative delay %q: %w", value, ErrNoRetryAfter)
+		}
+		return time.Duration(seconds) * time.Second, nil
 	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q: %w", value, ErrNoRetryAfter)
+	}
+	if wait := at.Sub(now); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
 }
 
+// checkRetry retries transport and 5xx errors, 429 is left to the caller to cool down.
 func checkRetry(ctx context.Context, res *http.Response, err error) (bool, error) {
+	if err == nil && res != nil && res.StatusCode == http.StatusTooManyRequests {
+		return false, nil
+	}
 	check, err := retryablehttp.DefaultRetryPolicy(ctx, res, err)
 	if err != nil {
 		return false, fmt.Errorf("accrual error in default retry policy : %w", err)
@@ -0,0 +1,208 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestGetOrderInfo(t *testing.T) {
+	type response struct {
+		header map[string]string
+		body   string
+		status int
+	}
+	tests := []struct {
+		check    func(t *testing.T, info *AccrualOrderInfoShema, err error)
+		name     string
+		response response
+	}{
+		{
+			name:     "processed",
+			response: response{status: http.StatusOK, body: `{"order":"1","status":"PROCESSED","accrual":500}`},
+			check: func(t *testing.T, info *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				require.NoError(t, err)
+				require.Equal(t, &AccrualOrderInfoShema{Order: "1", Status: models.PROCESSED, Accrual: 500}, info)
+			},
+		},
+		{
+			name:     "no order",
+			response: response{status: http.StatusNoContent},
+			check: func(t *testing.T, _ *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				require.ErrorIs(t, err, ErrNoOrder)
+			},
+		},
+		{
+			name:     "malformed json",
+			response: response{status: http.StatusOK, body: `{"order":`},
+			check: func(t *testing.T, _ *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				var malformedError *MalformedResponseError
+				require.ErrorAs(t, err, &malformedError)
+			},
+		},
+		{
+			name:     "unknown status",
+			response: response{status: http.StatusOK, body: `{"order":"1","status":"DONE"}`},
+			check: func(t *testing.T, _ *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				var malformedError *MalformedResponseError
+				require.ErrorAs(t, err, &malformedError)
+			},
+		},
+		{
+			name: "busy",
+			response: response{
+				status: http.StatusTooManyRequests,
+				header: map[string]string{"Retry-After": "60"},
+				body:   "No more than 30 requests per minute allowed",
+			},
+			check: func(t *testing.T, _ *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				var serviceBusyError *ServiceBusyError
+				require.ErrorAs(t, err, &serviceBusyError)
+				require.Equal(t, time.Minute, serviceBusyError.CoolDown)
+				require.Equal(t, 30, serviceBusyError.MaxRPM)
+			},
+		},
+		{
+			name:     "busy without retry after and rpm",
+			response: response{status: http.StatusTooManyRequests},
+			check: func(t *testing.T, _ *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				var serviceBusyError *ServiceBusyError
+				require.ErrorAs(t, err, &serviceBusyError)
+				require.ErrorIs(t, err, ErrNoRetryAfter)
+				require.Equal(t, DefaultCoolDown, serviceBusyError.CoolDown)
+			},
+		},
+		{
+			name:     "server error",
+			response: response{status: http.StatusServiceUnavailable},
+			check: func(t *testing.T, _ *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				var serverError *ServerError
+				require.ErrorAs(t, err, &serverError)
+				require.Equal(t, http.StatusServiceUnavailable, serverError.StatusCode)
+			},
+		},
+		{
+			name:     "client error",
+			response: response{status: http.StatusBadRequest},
+			check: func(t *testing.T, _ *AccrualOrderInfoShema, err error) {
+				t.Helper()
+				var clientError *ClientError
+				require.ErrorAs(t, err, &clientError)
+				require.True(t, clientError.OrderRejected())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.response.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.response.status)
+				_, _ = w.Write([]byte(tt.response.body))
+			}))
+			defer srv.Close()
+
+			client, err := NewAccrualClient(srv.URL, zap.L().Sugar())
+			require.NoError(t, err)
+			client.(*AccrualClient).client.RetryWaitMin = time.Millisecond
+			client.(*AccrualClient).client.RetryWaitMax = time.Millisecond
+
+			info, err := client.GetOrderInfo(context.Background(), "1")
+			tt.check(t, info, err)
+		})
+	}
+}
+
+func TestGetOrdersInfo(t *testing.T) {
+	var status int
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != OrdersBatchAPI {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var nums []string
+		if err := json.NewDecoder(r.Body).Decode(&nums); err != nil || len(nums) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	client, err := NewAccrualClient(srv.URL, zap.L().Sugar())
+	require.NoError(t, err)
+	_, ok := client.(BatchAccrual)
+	require.False(t, ok, "batch lookups must be enabled explicitly")
+
+	client, err = NewAccrualClient(srv.URL, zap.L().Sugar(), WithBatchLookups(true))
+	require.NoError(t, err)
+	batch, ok := client.(BatchAccrual)
+	require.True(t, ok)
+	ctx := context.Background()
+
+	status, body = http.StatusOK, `[{"order":"1","status":"PROCESSED","accrual":500}]`
+	infos, err := batch.GetOrdersInfo(ctx, []string{"1", "2"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]*AccrualOrderInfoShema{
+		"1": {Order: "1", Status: models.PROCESSED, Accrual: 500},
+	}, infos)
+
+	status, body = http.StatusOK, `[{"order":"3","status":"PROCESSED"}]`
+	var malformedError *MalformedResponseError
+	_, err = batch.GetOrdersInfo(ctx, []string{"1", "2"})
+	require.ErrorAs(t, err, &malformedError)
+
+	status, body = http.StatusTooManyRequests, "No more than 30 requests per minute allowed"
+	var serviceBusyError *ServiceBusyError
+	_, err = batch.GetOrdersInfo(ctx, []string{"1", "2"})
+	require.ErrorAs(t, err, &serviceBusyError)
+	require.Equal(t, 30, serviceBusyError.MaxRPM)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "http date", value: "Tue, 01 Aug 2023 12:01:30 GMT", want: 90 * time.Second},
+		{name: "http date in the past", value: "Tue, 01 Aug 2023 11:00:00 GMT", want: 0},
+		{name: "missing", value: "", wantErr: true},
+		{name: "negative", value: "-1", wantErr: true},
+		{name: "garbage", value: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRetryAfter(tt.value, now)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrNoRetryAfter)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
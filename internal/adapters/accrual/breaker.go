@@ -0,0 +1,208 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerOpenError is returned without calling accrual while the breaker is open.
+type BreakerOpenError struct {
+	// Backend is the routed backend whose breaker is open, empty for a breaker guarding all of accrual.
+	Backend string
+	// Remaining is the time left until the breaker lets a probe request through.
+	Remaining time.Duration
+}
+
+func (boe *BreakerOpenError) Error() string {
+	if boe.Backend != "" {
+		return fmt.Sprintf("accrual backend %v circuit breaker is open, retry in %v", boe.Backend, boe.Remaining)
+	}
+	return fmt.Sprintf("accrual circuit breaker is open, retry in %v", boe.Remaining)
+}
+
+type BreakerConfig struct {
+	// Failures is the number of consecutive failed calls that opens the breaker.
+	Failures int
+	// OpenTimeout is how long the breaker stays open before going half-open.
+	OpenTimeout time.Duration
+	// HalfOpenSuccesses is the number of successful probes that closes the breaker again.
+	HalfOpenSuccesses int
+}
+
+// Breaker is a circuit breaker guarding accrual. Server and transport errors count as failures,
+// any other answer means accrual is up. While half-open a single probe call is let through at a time.
+type Breaker struct {
+	openedAt  time.Time
+	now       func() time.Time
+	state     BreakerState
+	config    BreakerConfig
+	failures  int
+	successes int
+	mu        sync.Mutex
+	probing   bool
+}
+
+func NewBreaker(config BreakerConfig) *Breaker {
+	if config.Failures < 1 {
+		config.Failures = 1
+	}
+	if config.HalfOpenSuccesses < 1 {
+		config.HalfOpenSuccesses = 1
+	}
+
+	return &Breaker{
+		config: config,
+		state:  BreakerClosed,
+		now:    time.Now,
+	}
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	return b.state
+}
+
+// refresh moves an open breaker to half-open once OpenTimeout has passed. The caller must hold b.mu.
+func (b *Breaker) refresh() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.successes = 0
+		b.probing = false
+	}
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	switch b.state {
+	case BreakerOpen:
+		return &BreakerOpenError{Remaining: b.config.OpenTimeout - b.now().Sub(b.openedAt)}
+	case BreakerHalfOpen:
+		if b.probing {
+			return &BreakerOpenError{}
+		}
+		b.probing = true
+	case BreakerClosed:
+	}
+	return nil
+}
+
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbing := b.probing
+	b.probing = false
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Cancelled by the caller, says nothing about accrual.
+	case isBreakerFailure(err):
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.config.Failures {
+			b.open()
+		}
+	case b.state == BreakerHalfOpen && wasProbing:
+		b.successes++
+		if b.successes >= b.config.HalfOpenSuccesses {
+			b.state = BreakerClosed
+			b.failures = 0
+		}
+	default:
+		b.failures = 0
+	}
+}
+
+// open trips the breaker. The caller must hold b.mu.
+func (b *Breaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.failures = 0
+	b.successes = 0
+}
+
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var (
+		serverError      *ServerError
+		serviceBusyError *ServiceBusyError
+		clientError      *ClientError
+		malformedError   *MalformedResponseError
+	)
+	switch {
+	case errors.As(err, &serverError):
+		return true
+	case errors.Is(err, ErrNoOrder),
+		errors.Is(err, ErrNoBackend),
+		errors.As(err, &serviceBusyError),
+		errors.As(err, &clientError),
+		errors.As(err, &malformedError):
+		return false
+	default:
+		// Transport errors: accrual did not answer at all.
+		return true
+	}
+}
+
+type breakerAccrual struct {
+	next    Accrual
+	breaker *Breaker
+}
+
+type breakerBatchAccrual struct {
+	breakerAccrual
+	batch BatchAccrual
+}
+
+// WithBreaker wraps next so that its calls are short-circuited with BreakerOpenError while b is open.
+// The result implements BatchAccrual if next does.
+func WithBreaker(next Accrual, b *Breaker) Accrual {
+	if batch, ok := next.(BatchAccrual); ok {
+		return &breakerBatchAccrual{breakerAccrual: breakerAccrual{next: next, breaker: b}, batch: batch}
+	}
+	return &breakerAccrual{next: next, breaker: b}
+}
+
+func (ba *breakerAccrual) GetOrderInfo(ctx context.Context, num string) (*AccrualOrderInfoShema, error) {
+	if err := ba.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	info, err := ba.next.GetOrderInfo(ctx, num)
+	ba.breaker.record(ctx, err)
+
+	return info, err //nolint:wrapcheck // errors of the wrapped client are already typed
+}
+
+func (bba *breakerBatchAccrual) GetOrdersInfo(
+	ctx context.Context,
+	nums []string,
+) (map[string]*AccrualOrderInfoShema, error) {
+	if err := bba.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	infos, err := bba.batch.GetOrdersInfo(ctx, nums)
+	bba.breaker.record(ctx, err)
+
+	return infos, err //nolint:wrapcheck // errors of the wrapped client are already typed
+}
@@ -0,0 +1,114 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubAccrual struct {
+	err   error
+	calls int
+}
+
+func (s *stubAccrual) GetOrderInfo(context.Context, string) (*AccrualOrderInfoShema, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewBreaker(BreakerConfig{Failures: 2, OpenTimeout: time.Minute, HalfOpenSuccesses: 2})
+	breaker.now = func() time.Time { return now }
+
+	next := &stubAccrual{err: &ServerError{StatusCode: http.StatusBadGateway}}
+	client := WithBreaker(next, breaker)
+	ctx := context.Background()
+
+	_, err := client.GetOrderInfo(ctx, "1")
+	require.ErrorAs(t, err, new(*ServerError))
+	require.Equal(t, BreakerClosed, breaker.State())
+
+	_, err = client.GetOrderInfo(ctx, "1")
+	require.ErrorAs(t, err, new(*ServerError))
+	require.Equal(t, BreakerOpen, breaker.State())
+
+	var openError *BreakerOpenError
+	_, err = client.GetOrderInfo(ctx, "1")
+	require.ErrorAs(t, err, &openError)
+	require.Equal(t, time.Minute, openError.Remaining)
+	require.Equal(t, 2, next.calls)
+
+	// A failed probe opens the breaker again.
+	now = now.Add(time.Minute)
+	require.Equal(t, BreakerHalfOpen, breaker.State())
+	_, err = client.GetOrderInfo(ctx, "1")
+	require.ErrorAs(t, err, new(*ServerError))
+	require.Equal(t, BreakerOpen, breaker.State())
+
+	// Accrual answering at all counts as a successful probe.
+	now = now.Add(time.Minute)
+	next.err = ErrNoOrder
+	_, err = client.GetOrderInfo(ctx, "1")
+	require.ErrorIs(t, err, ErrNoOrder)
+	require.Equal(t, BreakerHalfOpen, breaker.State())
+	_, err = client.GetOrderInfo(ctx, "1")
+	require.ErrorIs(t, err, ErrNoOrder)
+	require.Equal(t, BreakerClosed, breaker.State())
+}
+
+func TestBreakerIgnoresCancelledCalls(t *testing.T) {
+	breaker := NewBreaker(BreakerConfig{Failures: 1, OpenTimeout: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	breaker.record(ctx, context.Canceled)
+	require.Equal(t, BreakerClosed, breaker.State())
+
+	breaker.record(context.Background(), errors.New("connection refused"))
+	require.Equal(t, BreakerOpen, breaker.State())
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewBreaker(BreakerConfig{Failures: 1, OpenTimeout: time.Minute})
+	breaker.now = func() time.Time { return now }
+	breaker.record(context.Background(), &ServerError{StatusCode: http.StatusInternalServerError})
+
+	now = now.Add(time.Minute)
+	require.NoError(t, breaker.allow())
+	require.ErrorAs(t, breaker.allow(), new(*BreakerOpenError))
+}
+
+type stubBatchAccrual struct {
+	batchErr error
+	infos    map[string]*AccrualOrderInfoShema
+	stubAccrual
+	batchCalls int
+}
+
+func (s *stubBatchAccrual) GetOrdersInfo(context.Context, []string) (map[string]*AccrualOrderInfoShema, error) {
+	s.batchCalls++
+	return s.infos, s.batchErr
+}
+
+func TestWithBreakerKeepsBatchCapability(t *testing.T) {
+	breaker := NewBreaker(BreakerConfig{Failures: 1, OpenTimeout: time.Minute})
+
+	_, ok := WithBreaker(&stubAccrual{}, breaker).(BatchAccrual)
+	require.False(t, ok)
+
+	next := &stubBatchAccrual{batchErr: &ServerError{StatusCode: http.StatusInternalServerError}}
+	client, ok := WithBreaker(next, breaker).(BatchAccrual)
+	require.True(t, ok)
+
+	_, err := client.GetOrdersInfo(context.Background(), []string{"1", "2"})
+	require.ErrorAs(t, err, new(*ServerError))
+	_, err = client.GetOrdersInfo(context.Background(), []string{"1", "2"})
+	require.ErrorAs(t, err, new(*BreakerOpenError))
+	require.Equal(t, 1, next.batchCalls)
+}
@@ -0,0 +1,266 @@
+// Package fake is a stand-in for the accrual system that answers GET /api/orders/{number}
+// and POST /api/orders/batch according to scripted rules. It is used by cmd/accrual-fake and by integration tests.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/adapters/accrual"
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+type Outcome string
+
+const (
+	// OutcomeProcessed ends with PROCESSED and the rule's accrual.
+	OutcomeProcessed Outcome = "PROCESSED"
+	// OutcomeInvalid ends with INVALID.
+	OutcomeInvalid Outcome = "INVALID"
+	// OutcomeUnknown answers 204, the order is not registered.
+	OutcomeUnknown Outcome = "UNKNOWN"
+	// OutcomeError answers 500.
+	OutcomeError Outcome = "ERROR"
+)
+
+// Rule scripts the answers for order numbers starting with Prefix, an empty prefix matches any order.
+// PROCESSED and INVALID orders are REGISTERED for the first half of Delay after the first request,
+// PROCESSING for the second half and final afterwards.
+type Rule struct {
+	Prefix  string
+	Outcome Outcome
+	Accrual float64
+	Delay   time.Duration
+}
+
+type Config struct {
+	// Rules are matched in order, orders no rule matches are unknown.
+	Rules []Rule
+	// RPM limits requests per minute, over the limit the server answers 429. Zero means no limit.
+	RPM int
+}
+
+type Server struct {
+	firstSeen   map[string]time.Time
+	windowStart time.Time
+	now         func() time.Time
+	config      Config
+	requests    int
+	mu          sync.Mutex
+}
+
+func NewServer(config Config) *Server {
+	return &Server{
+		config:    config,
+		firstSeen: make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+// Handler serves GET /api/orders/{number} and POST /api/orders/batch, see accrual.OrdersBatchAPI.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(accrual.OrdersAPI, s.getOrder)
+	mux.HandleFunc(accrual.OrdersBatchAPI, s.getOrders)
+	return mux
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	number := strings.TrimPrefix(r.URL.Path, accrual.OrdersAPI)
+	if number == "" || strings.Contains(number, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	retryAfter, limited := s.limit(now)
+	var firstSeen time.Time
+	if !limited {
+		firstSeen = s.seen(number, now)
+	}
+	s.mu.Unlock()
+
+	if limited {
+		s.writeLimited(w, retryAfter)
+		return
+	}
+
+	info, outcome := s.info(number, firstSeen, now)
+	switch outcome {
+	case OutcomeUnknown:
+		w.WriteHeader(http.StatusNoContent)
+	case OutcomeError:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(info)
+	}
+}
+
+// getOrders answers a JSON array of order numbers with an array of the known ones. A batch containing
+// an order with the ERROR outcome fails as a whole with 500.
+func (s *Server) getOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var numbers []string
+	if err := json.NewDecoder(r.Body).Decode(&numbers); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	retryAfter, limited := s.limit(now)
+	firstSeen := make([]time.Time, len(numbers))
+	if !limited {
+		for i, number := range numbers {
+			firstSeen[i] = s.seen(number, now)
+		}
+	}
+	s.mu.Unlock()
+
+	if limited {
+		s.writeLimited(w, retryAfter)
+		return
+	}
+
+	infos := make([]accrual.AccrualOrderInfoShema, 0, len(numbers))
+	for i, number := range numbers {
+		info, outcome := s.info(number, firstSeen[i], now)
+		switch outcome {
+		case OutcomeUnknown:
+		case OutcomeError:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		default:
+			infos = append(infos, info)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(infos)
+}
+
+// info returns the answer for the order first asked about at firstSeen. Orders no rule matches are unknown.
+func (s *Server) info(number string, firstSeen, now time.Time) (accrual.AccrualOrderInfoShema, Outcome) {
+	rule, ok := s.match(number)
+	if !ok {
+		return accrual.AccrualOrderInfoShema{}, OutcomeUnknown
+	}
+	if rule.Outcome == OutcomeUnknown || rule.Outcome == OutcomeError {
+		return accrual.AccrualOrderInfoShema{}, rule.Outcome
+	}
+
+	info := accrual.AccrualOrderInfoShema{Order: number}
+	elapsed := now.Sub(firstSeen)
+	switch {
+	case elapsed < rule.Delay/2:
+		info.Status = models.REGISTERED
+	case elapsed < rule.Delay:
+		info.Status = models.PROCESSING
+	case rule.Outcome == OutcomeInvalid:
+		info.Status = models.INVALID
+	default:
+		info.Status = models.PROCESSED
+		info.Accrual = rule.Accrual
+	}
+	return info, rule.Outcome
+}
+
+func (s *Server) writeLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	w.WriteHeader(http.StatusTooManyRequests)
+	_, _ = fmt.Fprintf(w, "No more than %d requests per minute allowed", s.config.RPM)
+}
+
+// limit counts the request in the current minute and reports how long to wait if it is over RPM.
+// The caller must hold s.mu.
+func (s *Server) limit(now time.Time) (time.Duration, bool) {
+	if s.config.RPM <= 0 {
+		return 0, false
+	}
+
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.requests = 0
+	}
+	if s.requests >= s.config.RPM {
+		return s.windowStart.Add(time.Minute).Sub(now).Round(time.Second), true
+	}
+	s.requests++
+	return 0, false
+}
+
+// seen returns when the order was first asked about. The caller must hold s.mu.
+func (s *Server) seen(number string, now time.Time) time.Time {
+	firstSeen, ok := s.firstSeen[number]
+	if !ok {
+		firstSeen = now
+		s.firstSeen[number] = now
+	}
+	return firstSeen
+}
+
+func (s *Server) match(number string) (Rule, bool) {
+	for _, rule := range s.config.Rules {
+		if strings.HasPrefix(number, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// ParseRules parses rules in the "prefix:outcome[:accrual[:delay]],..." form,
+// e.g. "1:PROCESSED:500:10s,2:INVALID,3:UNKNOWN,:PROCESSED:100".
+func ParseRules(spec string) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	if strings.TrimSpace(spec) == "" {
+		return rules, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("malformed rule %q, want prefix:outcome[:accrual[:delay]]", part)
+		}
+
+		rule := Rule{Prefix: fields[0], Outcome: Outcome(strings.ToUpper(fields[1]))}
+		switch rule.Outcome {
+		case OutcomeProcessed, OutcomeInvalid, OutcomeUnknown, OutcomeError:
+		default:
+			return nil, fmt.Errorf("unknown outcome %q of rule %q", fields[1], part)
+		}
+
+		if len(fields) > 2 && fields[2] != "" {
+			accrualSum, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil || accrualSum < 0 {
+				return nil, fmt.Errorf("malformed accrual of rule %q", part)
+			}
+			rule.Accrual = accrualSum
+		}
+		if len(fields) > 3 {
+			delay, err := time.ParseDuration(fields[3])
+			if err != nil || delay < 0 {
+				return nil, fmt.Errorf("malformed delay of rule %q", part)
+			}
+			rule.Delay = delay
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
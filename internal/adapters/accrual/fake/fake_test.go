@@ -0,0 +1,100 @@
+package fake
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/adapters/accrual"
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestServer(t *testing.T) {
+	rules, err := ParseRules("1:PROCESSED:500:10s,2:INVALID,3:UNKNOWN")
+	require.NoError(t, err)
+
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewServer(Config{Rules: rules, RPM: 5})
+	fake.now = func() time.Time { return now }
+
+	srv := httptest.NewServer(fake.Handler())
+	defer srv.Close()
+
+	client, err := accrual.NewAccrualClient(srv.URL, zap.L().Sugar())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	info, err := client.GetOrderInfo(ctx, "12345678903")
+	require.NoError(t, err)
+	require.Equal(t, models.REGISTERED, info.Status)
+
+	now = now.Add(5 * time.Second)
+	info, err = client.GetOrderInfo(ctx, "12345678903")
+	require.NoError(t, err)
+	require.Equal(t, models.PROCESSING, info.Status)
+
+	now = now.Add(5 * time.Second)
+	info, err = client.GetOrderInfo(ctx, "12345678903")
+	require.NoError(t, err)
+	require.Equal(t, &accrual.AccrualOrderInfoShema{Order: "12345678903", Status: models.PROCESSED, Accrual: 500}, info)
+
+	info, err = client.GetOrderInfo(ctx, "2377225624")
+	require.NoError(t, err)
+	require.Equal(t, models.INVALID, info.Status)
+
+	_, err = client.GetOrderInfo(ctx, "3")
+	require.ErrorIs(t, err, accrual.ErrNoOrder)
+
+	now = now.Add(20 * time.Second)
+	var serviceBusyError *accrual.ServiceBusyError
+	_, err = client.GetOrderInfo(ctx, "4")
+	require.ErrorAs(t, err, &serviceBusyError)
+	require.Equal(t, 5, serviceBusyError.MaxRPM)
+	require.Equal(t, 30*time.Second, serviceBusyError.CoolDown)
+}
+
+func TestServerBatch(t *testing.T) {
+	rules, err := ParseRules("1:PROCESSED:500,2:INVALID:0:10s,3:UNKNOWN,4:ERROR")
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(NewServer(Config{Rules: rules}).Handler())
+	defer srv.Close()
+
+	client, err := accrual.NewAccrualClient(srv.URL, zap.L().Sugar(), accrual.WithBatchLookups(true))
+	require.NoError(t, err)
+	batch, ok := client.(accrual.BatchAccrual)
+	require.True(t, ok)
+	ctx := context.Background()
+
+	infos, err := batch.GetOrdersInfo(ctx, []string{"12345678903", "2377225624", "3"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]*accrual.AccrualOrderInfoShema{
+		"12345678903": {Order: "12345678903", Status: models.PROCESSED, Accrual: 500},
+		"2377225624":  {Order: "2377225624", Status: models.REGISTERED},
+	}, infos)
+
+	// The client retries 5xx, so the failing batch is checked without it.
+	res, err := http.Post(srv.URL+accrual.OrdersBatchAPI, "application/json", strings.NewReader(`["1","4"]`))
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("1:processed:500:10s, :UNKNOWN")
+	require.NoError(t, err)
+	require.Equal(t, []Rule{
+		{Prefix: "1", Outcome: OutcomeProcessed, Accrual: 500, Delay: 10 * time.Second},
+		{Prefix: "", Outcome: OutcomeUnknown},
+	}, rules)
+
+	for _, spec := range []string{"1", "1:DONE", "1:PROCESSED:lots", "1:PROCESSED:1:soon", "1:INVALID:0:1s:extra"} {
+		_, err := ParseRules(spec)
+		require.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,50 @@
+package accrual
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter spaces requests evenly so that no more than rpm are sent per minute.
+type limiter struct {
+	next     time.Time
+	now      func() time.Time
+	interval time.Duration
+	mu       sync.Mutex
+}
+
+func newLimiter(rpm int) *limiter {
+	return &limiter{interval: time.Minute / time.Duration(rpm), now: time.Now}
+}
+
+// reserve takes the next free slot and returns how long to wait for it.
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
+
+// wait blocks until the request may be sent or ctx is done.
+func (l *limiter) wait(ctx context.Context) error {
+	d := l.reserve()
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck // the caller wraps it
+	case <-timer.C:
+		return nil
+	}
+}
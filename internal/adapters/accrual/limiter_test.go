@@ -0,0 +1,27 @@
+package accrual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(60)
+	l.now = func() time.Time { return now }
+
+	require.Equal(t, time.Duration(0), l.reserve())
+	require.Equal(t, time.Second, l.reserve())
+	require.Equal(t, 2*time.Second, l.reserve())
+
+	// Unused slots are not saved up.
+	now = now.Add(time.Minute)
+	require.Equal(t, time.Duration(0), l.reserve())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, l.wait(ctx), context.Canceled)
+}
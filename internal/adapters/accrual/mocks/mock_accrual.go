@@ -1,14 +1,15 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: internal/app/accrual.go
+// Source: internal/adapters/accrual/accrual.go
 
 // Package mocks is a generated GoMock package.
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
-	"github.com/rawen554/go-loyal/internal/adapters/accrual"
+	accrual "github.com/rawen554/go-loyal/internal/adapters/accrual"
 )
 
 // MockAccrual is a mock of Accrual interface.
@@ -35,16 +36,69 @@ func (m *MockAccrual) EXPECT() *MockAccrualMockRecorder {
 }
 
 // GetOrderInfo mocks base method.
-func (m *MockAccrual) GetOrderInfo(num string) (*accrual.AccrualOrderInfoShema, error) {
+func (m *MockAccrual) GetOrderInfo(ctx context.Context, num string) (*accrual.AccrualOrderInfoShema, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrderInfo", num)
+	ret := m.ctrl.Call(m, "GetOrderInfo", ctx, num)
 	ret0, _ := ret[0].(*accrual.AccrualOrderInfoShema)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOrderInfo indicates an expected call of GetOrderInfo.
-func (mr *MockAccrualMockRecorder) GetOrderInfo(num interface{}) *gomock.Call {
+func (mr *MockAccrualMockRecorder) GetOrderInfo(ctx, num interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderInfo", reflect.TypeOf((*MockAccrual)(nil).GetOrderInfo), num)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderInfo", reflect.TypeOf((*MockAccrual)(nil).GetOrderInfo), ctx, num)
+}
+
+// MockBatchAccrual is a mock of BatchAccrual interface.
+type MockBatchAccrual struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchAccrualMockRecorder
+}
+
+// MockBatchAccrualMockRecorder is the mock recorder for MockBatchAccrual.
+type MockBatchAccrualMockRecorder struct {
+	mock *MockBatchAccrual
+}
+
+// NewMockBatchAccrual creates a new mock instance.
+func NewMockBatchAccrual(ctrl *gomock.Controller) *MockBatchAccrual {
+	mock := &MockBatchAccrual{ctrl: ctrl}
+	mock.recorder = &MockBatchAccrualMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatchAccrual) EXPECT() *MockBatchAccrualMockRecorder {
+	return m.recorder
+}
+
+// GetOrderInfo mocks base method.
+func (m *MockBatchAccrual) GetOrderInfo(ctx context.Context, num string) (*accrual.AccrualOrderInfoShema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderInfo", ctx, num)
+	ret0, _ := ret[0].(*accrual.AccrualOrderInfoShema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderInfo indicates an expected call of GetOrderInfo.
+func (mr *MockBatchAccrualMockRecorder) GetOrderInfo(ctx, num interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderInfo", reflect.TypeOf((*MockBatchAccrual)(nil).GetOrderInfo), ctx, num)
+}
+
+// GetOrdersInfo mocks base method.
+func (m *MockBatchAccrual) GetOrdersInfo(ctx context.Context, nums []string) (map[string]*accrual.AccrualOrderInfoShema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrdersInfo", ctx, nums)
+	ret0, _ := ret[0].(map[string]*accrual.AccrualOrderInfoShema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrdersInfo indicates an expected call of GetOrdersInfo.
+func (mr *MockBatchAccrualMockRecorder) GetOrdersInfo(ctx, nums interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersInfo", reflect.TypeOf((*MockBatchAccrual)(nil).GetOrdersInfo), ctx, nums)
 }
@@ -0,0 +1,258 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoBackend = errors.New("no accrual backend serves the order")
+var ErrInvertedRange = errors.New("range starts after its end")
+
+// Range is an inclusive range of order numbers compared as integers of any length.
+type Range struct {
+	From string
+	To   string
+}
+
+// NewRange returns the range of order numbers between from and to, from must not be greater than to.
+func NewRange(from, to string) (Range, error) {
+	if CompareNumbers(from, to) > 0 {
+		return Range{}, fmt.Errorf("range %v-%v: %w", from, to, ErrInvertedRange)
+	}
+	return Range{From: from, To: to}, nil
+}
+
+func (r Range) Contains(num string) bool {
+	return CompareNumbers(r.From, num) <= 0 && CompareNumbers(num, r.To) <= 0
+}
+
+// CompareNumbers compares decimal order numbers without limiting their length.
+func CompareNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Backend is an accrual system serving order numbers that start with one of Prefixes or fall into
+// one of Ranges. A backend without prefixes and ranges serves any order.
+// Calls to a backend with a Breaker are guarded by it, so a failing backend does not stop the others.
+type Backend struct {
+	Client   Accrual
+	Breaker  *Breaker
+	Name     string
+	Prefixes []string
+	Ranges   []Range
+}
+
+func (b *Backend) serves(num string) bool {
+	if len(b.Prefixes) == 0 && len(b.Ranges) == 0 {
+		return true
+	}
+	for _, prefix := range b.Prefixes {
+		if strings.HasPrefix(num, prefix) {
+			return true
+		}
+	}
+	for _, r := range b.Ranges {
+		if r.Contains(num) {
+			return true
+		}
+	}
+	return false
+}
+
+type routedBackend struct {
+	busyUntil time.Time
+	Backend
+	mu sync.Mutex
+}
+
+// Router dispatches lookups to the first backend serving the order. A backend answering 429 is not
+// called until its Retry-After passes, lookups routed to it meanwhile fail with ServiceBusyError
+// naming the backend, so other backends keep working.
+// Router implements BatchAccrual: orders are grouped by backend and every group is looked up in one
+// request if the backend implements BatchAccrual, otherwise one by one.
+type Router struct {
+	now      func() time.Time
+	backends []*routedBackend
+}
+
+func NewRouter(backends ...Backend) *Router {
+	routed := make([]*routedBackend, 0, len(backends))
+	for _, b := range backends {
+		if b.Breaker != nil {
+			b.Client = WithBreaker(b.Client, b.Breaker)
+		}
+		routed = append(routed, &routedBackend{Backend: b})
+	}
+	return &Router{backends: routed, now: time.Now}
+}
+
+// BreakerStates returns the breaker states of the backends that have one, by backend name.
+func (r *Router) BreakerStates() map[string]BreakerState {
+	states := make(map[string]BreakerState, len(r.backends))
+	for _, b := range r.backends {
+		if b.Breaker != nil {
+			states[b.Name] = b.Breaker.State()
+		}
+	}
+	return states
+}
+
+func (r *Router) route(num string) *routedBackend {
+	for _, b := range r.backends {
+		if b.serves(num) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (r *Router) GetOrderInfo(ctx context.Context, num string) (*AccrualOrderInfoShema, error) {
+	b := r.route(num)
+	if b == nil {
+		return nil, ErrNoBackend
+	}
+	if err := r.busyError(b); err != nil {
+		return nil, err
+	}
+
+	info, err := b.Client.GetOrderInfo(ctx, num)
+	if err != nil {
+		return nil, r.backendError(b, err)
+	}
+	return info, nil
+}
+
+// GetOrdersInfo returns BatchError naming the orders whose lookup failed, together with the infos of the others.
+// A group its backend rejects as a whole is looked up one by one. After an error concerning the backend itself
+// the rest of its group is not looked up and fails with the same error.
+func (r *Router) GetOrdersInfo(ctx context.Context, nums []string) (map[string]*AccrualOrderInfoShema, error) {
+	infos := make(map[string]*AccrualOrderInfoShema, len(nums))
+	errs := make(map[string]error)
+
+	backends := make([]*routedBackend, 0, len(r.backends))
+	groups := make(map[*routedBackend][]string, len(r.backends))
+	for _, num := range nums {
+		b := r.route(num)
+		if b == nil {
+			errs[num] = ErrNoBackend
+			continue
+		}
+		if _, ok := groups[b]; !ok {
+			backends = append(backends, b)
+		}
+		groups[b] = append(groups[b], num)
+	}
+
+	for _, b := range backends {
+		r.lookupGroup(ctx, b, groups[b], infos, errs)
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("batch lookup interrupted: %w", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return infos, &BatchError{Errs: errs}
+	}
+	return infos, nil
+}
+
+func (r *Router) lookupGroup(
+	ctx context.Context,
+	b *routedBackend,
+	nums []string,
+	infos map[string]*AccrualOrderInfoShema,
+	errs map[string]error,
+) {
+	var (
+		clientError    *ClientError
+		malformedError *MalformedResponseError
+	)
+
+	if batch, ok := b.Client.(BatchAccrual); ok && len(nums) > 1 {
+		err := r.busyError(b)
+		if err == nil {
+			var found map[string]*AccrualOrderInfoShema
+			found, err = batch.GetOrdersInfo(ctx, nums)
+			if err == nil {
+				for num, info := range found {
+					infos[num] = info
+				}
+				return
+			}
+		}
+		if !errors.As(err, &clientError) && !errors.As(err, &malformedError) {
+			err = r.backendError(b, err)
+			for _, num := range nums {
+				errs[num] = err
+			}
+			return
+		}
+	}
+
+	for i, num := range nums {
+		info, err := r.GetOrderInfo(ctx, num)
+		switch {
+		case err == nil:
+			infos[num] = info
+		case errors.Is(err, ErrNoOrder):
+		case errors.As(err, &clientError) && clientError.OrderRejected(), errors.As(err, &malformedError):
+			errs[num] = err
+		default:
+			for _, rest := range nums[i:] {
+				errs[rest] = err
+			}
+			return
+		}
+	}
+}
+
+// busyError fails lookups routed to b until its Retry-After passes.
+func (r *Router) busyError(b *routedBackend) error {
+	b.mu.Lock()
+	wait := b.busyUntil.Sub(r.now())
+	b.mu.Unlock()
+	if wait > 0 {
+		return &ServiceBusyError{CoolDown: wait, Backend: b.Name, Err: ErrServiceBusy}
+	}
+	return nil
+}
+
+// backendError names b in the errors that only stop its own lookups and remembers its Retry-After.
+func (r *Router) backendError(b *routedBackend, err error) error {
+	var (
+		serviceBusyError *ServiceBusyError
+		breakerOpenError *BreakerOpenError
+	)
+	if errors.As(err, &breakerOpenError) {
+		return &BreakerOpenError{Backend: b.Name, Remaining: breakerOpenError.Remaining}
+	}
+	if errors.As(err, &serviceBusyError) {
+		if serviceBusyError.Backend != "" {
+			return err
+		}
+		b.mu.Lock()
+		b.busyUntil = r.now().Add(serviceBusyError.CoolDown)
+		b.mu.Unlock()
+
+		return &ServiceBusyError{
+			CoolDown: serviceBusyError.CoolDown,
+			MaxRPM:   serviceBusyError.MaxRPM,
+			Backend:  b.Name,
+			Err:      serviceBusyError.Err,
+		}
+	}
+
+	return err //nolint:wrapcheck // errors of the backend clients are already typed
+}
@@ -0,0 +1,146 @@
+package accrual
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	eu := &stubAccrual{err: ErrNoOrder}
+	us := &stubAccrual{err: ErrNoOrder}
+	router := NewRouter(
+		Backend{Name: "eu", Client: eu, Prefixes: []string{"4"}},
+		Backend{Name: "us", Client: us, Ranges: []Range{{From: "500", To: "9999"}}},
+	)
+	ctx := context.Background()
+
+	for _, num := range []string{"4", "42"} {
+		_, err := router.GetOrderInfo(ctx, num)
+		require.ErrorIs(t, err, ErrNoOrder)
+	}
+	for _, num := range []string{"500", "0777", "9999"} {
+		_, err := router.GetOrderInfo(ctx, num)
+		require.ErrorIs(t, err, ErrNoOrder)
+	}
+	require.Equal(t, 2, eu.calls)
+	require.Equal(t, 3, us.calls)
+
+	for _, num := range []string{"399", "10000", "12345678903"} {
+		_, err := router.GetOrderInfo(ctx, num)
+		require.ErrorIs(t, err, ErrNoBackend, num)
+	}
+}
+
+func TestNewRange(t *testing.T) {
+	r, err := NewRange("0500", "9999")
+	require.NoError(t, err)
+	require.True(t, r.Contains("777"))
+
+	_, err = NewRange("9999", "500")
+	require.ErrorIs(t, err, ErrInvertedRange)
+}
+
+func TestRouterBusyBackend(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	eu := &stubAccrual{err: NewServiceBusyError(time.Minute, 10, ErrServiceBusy)}
+	fallback := &stubAccrual{err: ErrNoOrder}
+	router := NewRouter(
+		Backend{Name: "eu", Client: eu, Prefixes: []string{"4"}},
+		Backend{Name: "default", Client: fallback},
+	)
+	router.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	var serviceBusyError *ServiceBusyError
+	_, err := router.GetOrderInfo(ctx, "42")
+	require.ErrorAs(t, err, &serviceBusyError)
+	require.Equal(t, "eu", serviceBusyError.Backend)
+	require.Equal(t, 10, serviceBusyError.MaxRPM)
+
+	now = now.Add(20 * time.Second)
+	_, err = router.GetOrderInfo(ctx, "43")
+	require.ErrorAs(t, err, &serviceBusyError)
+	require.Equal(t, 40*time.Second, serviceBusyError.CoolDown)
+	require.Equal(t, 1, eu.calls, "busy backend must not be called before Retry-After")
+
+	_, err = router.GetOrderInfo(ctx, "12345678903")
+	require.ErrorIs(t, err, ErrNoOrder)
+	require.Equal(t, 1, fallback.calls)
+
+	now = now.Add(40 * time.Second)
+	_, err = router.GetOrderInfo(ctx, "44")
+	require.ErrorAs(t, err, &serviceBusyError)
+	require.Equal(t, 2, eu.calls)
+}
+
+func TestRouterBackendBreaker(t *testing.T) {
+	eu := &stubAccrual{err: &ServerError{StatusCode: http.StatusInternalServerError}}
+	fallback := &stubAccrual{err: ErrNoOrder}
+	router := NewRouter(
+		Backend{Name: "eu", Client: eu, Breaker: NewBreaker(BreakerConfig{Failures: 1, OpenTimeout: time.Hour}),
+			Prefixes: []string{"4"}},
+		Backend{Name: "default", Client: fallback, Breaker: NewBreaker(BreakerConfig{Failures: 1})},
+	)
+	ctx := context.Background()
+
+	var serverError *ServerError
+	_, err := router.GetOrderInfo(ctx, "42")
+	require.ErrorAs(t, err, &serverError)
+
+	var breakerOpenError *BreakerOpenError
+	_, err = router.GetOrderInfo(ctx, "43")
+	require.ErrorAs(t, err, &breakerOpenError)
+	require.Equal(t, "eu", breakerOpenError.Backend)
+	require.Equal(t, 1, eu.calls, "backend with an open breaker must not be called")
+
+	_, err = router.GetOrderInfo(ctx, "12345678903")
+	require.ErrorIs(t, err, ErrNoOrder)
+	require.Equal(t, 1, fallback.calls)
+
+	require.Equal(t, map[string]BreakerState{"eu": BreakerOpen, "default": BreakerClosed}, router.BreakerStates())
+}
+
+func TestRouterBatch(t *testing.T) {
+	eu := &stubBatchAccrual{
+		stubAccrual: stubAccrual{err: ErrNoOrder},
+		infos:       map[string]*AccrualOrderInfoShema{"41": {Order: "41", Status: models.PROCESSED, Accrual: 10}},
+	}
+	us := &stubAccrual{err: &ClientError{StatusCode: http.StatusUnprocessableEntity}}
+	asia := &stubAccrual{err: &ServerError{StatusCode: http.StatusBadGateway}}
+	router := NewRouter(
+		Backend{Name: "eu", Client: eu, Prefixes: []string{"4"}},
+		Backend{Name: "us", Client: us, Prefixes: []string{"5"}},
+		Backend{Name: "asia", Client: asia, Prefixes: []string{"6"}},
+	)
+
+	infos, err := router.GetOrdersInfo(context.Background(), []string{"41", "42", "51", "52", "61", "62", "7"})
+	var batchError *BatchError
+	require.ErrorAs(t, err, &batchError)
+	require.Equal(t, map[string]*AccrualOrderInfoShema{
+		"41": {Order: "41", Status: models.PROCESSED, Accrual: 10},
+	}, infos)
+	require.Equal(t, 1, eu.batchCalls)
+	require.Equal(t, 0, eu.calls)
+	require.Equal(t, 2, us.calls)
+	require.Equal(t, 1, asia.calls, "backend failing on its own must not be called for the rest of the group")
+
+	require.Len(t, batchError.Errs, 5)
+	require.ErrorIs(t, batchError.Errs["7"], ErrNoBackend)
+	for _, num := range []string{"51", "52"} {
+		require.ErrorAs(t, batchError.Errs[num], new(*ClientError))
+	}
+	for _, num := range []string{"61", "62"} {
+		require.ErrorAs(t, batchError.Errs[num], new(*ServerError))
+	}
+
+	eu.batchErr = &ClientError{StatusCode: http.StatusNotFound}
+	infos, err = router.GetOrdersInfo(context.Background(), []string{"41", "42"})
+	require.NoError(t, err)
+	require.Empty(t, infos)
+	require.Equal(t, 2, eu.calls, "orders of a rejected batch must be looked up one by one")
+}
@@ -0,0 +1,95 @@
+package accrual
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var ErrNoCertificates = errors.New("no certificates found")
+
+// TLSFiles are PEM files of the client certificate for mutual TLS and of the CA bundle the accrual
+// server certificate is verified against. Empty CAFile means the system roots.
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// LoadTLSConfig reads files into a TLS config, it returns nil when no files are set.
+func LoadTLSConfig(files TLSFiles) (*tls.Config, error) {
+	if files == (TLSFiles{}) {
+		return nil, nil //nolint:nilnil // no TLS settings means the transport defaults
+	}
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if files.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if files.CAFile != "" {
+		pem, err := os.ReadFile(files.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("error parsing CA bundle %v: %w", files.CAFile, ErrNoCertificates)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// WithTLSConfig sets the TLS config of connections to accrual, see LoadTLSConfig.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(a *AccrualClient) {
+		if config != nil {
+			a.transport().TLSClientConfig = config
+		}
+	}
+}
+
+// WithProxy sends requests through proxy instead of the one from HTTP_PROXY and HTTPS_PROXY.
+func WithProxy(proxy *url.URL) ClientOption {
+	return func(a *AccrualClient) {
+		if proxy != nil {
+			a.transport().Proxy = http.ProxyURL(proxy)
+		}
+	}
+}
+
+// WithTimeout limits every attempt of a request, retries get their own timeout. Zero means no limit.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(a *AccrualClient) {
+		a.client.HTTPClient.Timeout = timeout
+	}
+}
+
+// WithHeaders adds static headers, e.g. Authorization, to every request.
+func WithHeaders(headers http.Header) ClientOption {
+	return func(a *AccrualClient) {
+		for name, values := range headers {
+			for _, value := range values {
+				a.headers.Add(name, value)
+			}
+		}
+	}
+}
+
+func (a *AccrualClient) transport() *http.Transport {
+	// retryablehttp.NewClient always uses a cleanhttp pooled transport.
+	return a.client.HTTPClient.Transport.(*http.Transport)
+}
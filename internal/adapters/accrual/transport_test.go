@@ -0,0 +1,132 @@
+package accrual
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gophermart"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return cert, certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"order": "1", "status": "PROCESSED", "accrual": 500}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, serverCA, 0o600))
+
+	tlsConfig, err := LoadTLSConfig(TLSFiles{CertFile: certFile, KeyFile: keyFile, CAFile: caFile})
+	require.NoError(t, err)
+
+	client, err := NewAccrualClient(srv.URL, zap.L().Sugar(),
+		WithTLSConfig(tlsConfig),
+		WithHeaders(http.Header{"Authorization": {"Bearer secret"}}),
+	)
+	require.NoError(t, err)
+	client.(*AccrualClient).client.RetryMax = 0
+
+	info, err := client.GetOrderInfo(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, 500.0, info.Accrual)
+
+	withoutCert, err := LoadTLSConfig(TLSFiles{CAFile: caFile})
+	require.NoError(t, err)
+	client, err = NewAccrualClient(srv.URL, zap.L().Sugar(), WithTLSConfig(withoutCert))
+	require.NoError(t, err)
+	client.(*AccrualClient).client.RetryMax = 0
+
+	_, err = client.GetOrderInfo(context.Background(), "1")
+	require.Error(t, err)
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	config, err := LoadTLSConfig(TLSFiles{})
+	require.NoError(t, err)
+	require.Nil(t, config)
+
+	dir := t.TempDir()
+	_, certFile, _ := writeClientCert(t, dir)
+
+	_, err = LoadTLSConfig(TLSFiles{CertFile: certFile})
+	require.Error(t, err)
+
+	notPEM := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	_, err = LoadTLSConfig(TLSFiles{CAFile: notPEM})
+	require.ErrorIs(t, err, ErrNoCertificates)
+}
+
+func TestWithTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := NewAccrualClient(srv.URL, zap.L().Sugar(), WithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	client.(*AccrualClient).client.RetryMax = 0
+
+	_, err = client.GetOrderInfo(context.Background(), "1")
+	require.Error(t, err)
+}
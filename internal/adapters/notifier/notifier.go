@@ -0,0 +1,79 @@
+package notifier
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	KindLog  = "log"
+	KindFile = "file"
+
+	fileMode = 0o600
+)
+
+type Notifier interface {
+	SendPasswordReset(login string, token string, expiresAt time.Time) error
+}
+
+func NewNotifier(kind string, path string, logger *zap.SugaredLogger) (Notifier, error) {
+	switch kind {
+	case KindLog:
+		return NewLogNotifier(logger), nil
+	case KindFile:
+		return NewFileNotifier(path), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier: %v", kind)
+	}
+}
+
+type LogNotifier struct {
+	logger *zap.SugaredLogger
+}
+
+func NewLogNotifier(logger *zap.SugaredLogger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) SendPasswordReset(login string, token string, expiresAt time.Time) error {
+	n.logger.Infow("password reset requested",
+		"login", login,
+		"token", token,
+		"expires_at", expiresAt.Format(time.RFC3339),
+	)
+	return nil
+}
+
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) SendPasswordReset(login string, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return fmt.Errorf("error opening notifications file: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "%s password reset for %q: token=%s expires_at=%s\n",
+		time.Now().Format(time.RFC3339), login, token, expiresAt.Format(time.RFC3339))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing notification: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/campaigns"
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+)
+
+func (db *DBStore) CreateCampaign(ctx context.Context, c *models.Campaign) error {
+	if err := db.conn.WithContext(ctx).Create(c).Error; err != nil {
+		return fmt.Errorf("error creating campaign: %w", err)
+	}
+	return nil
+}
+
+func (db *DBStore) GetCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	list := make([]models.Campaign, 0)
+	if err := db.conn.WithContext(ctx).Order("starts_at desc").Find(&list).Error; err != nil {
+		return nil, fmt.Errorf("error getting campaigns: %w", err)
+	}
+
+	if len(list) == 0 {
+		return nil, models.ErrUserHasNoItems
+	}
+
+	return list, nil
+}
+
+func (db *DBStore) DisableCampaign(ctx context.Context, id uint64) error {
+	result := db.conn.WithContext(ctx).Model(&models.Campaign{}).Where("id = ?", id).Update("active", false)
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error disabling campaign: %w", err)
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrCampaignNotFound
+	}
+	return nil
+}
+
+// applyCampaigns credits bonuses of the running campaigns to the just processed order.
+// The caller must hold the user lock, so per-user caps are not exceeded by concurrent orders.
+func (db *DBStore) applyCampaigns(tx *gorm.DB, order *models.Order) error {
+	now := time.Now()
+	running := make([]models.Campaign, 0)
+	result := tx.Where("active AND starts_at <= ? AND ends_at > ?", now, now).Find(&running)
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error getting running campaigns: %w", err)
+	}
+	if len(running) == 0 {
+		return nil
+	}
+
+	var processedBefore int64
+	result = tx.Model(&models.Order{}).
+		Where("user_id = ? AND status = ? AND number <> ?", order.UserID, models.PROCESSED, order.Number).
+		Count(&processedBefore)
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error counting processed orders: %w", err)
+	}
+
+	for i := range running {
+		var granted float64
+		result := tx.Model(&models.OrderBonus{}).
+			Select("COALESCE(SUM(amount), 0)").
+			Where("user_id = ? AND campaign_id = ?", order.UserID, running[i].ID).
+			Scan(&granted)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error getting granted bonuses: %w", err)
+		}
+
+		bonus := campaigns.Bonus(&running[i], campaigns.Order{
+			ProcessedAt: now,
+			Accrual:     order.Accrual,
+			FirstOrder:  processedBefore == 0,
+			Granted:     granted,
+		})
+		if bonus <= 0 {
+			continue
+		}
+
+		if err := tx.Create(&models.OrderBonus{
+			OrderNumber: order.Number,
+			CampaignID:  running[i].ID,
+			UserID:      order.UserID,
+			Amount:      bonus,
+		}).Error; err != nil {
+			return fmt.Errorf("error creating order bonus: %w", err)
+		}
+
+		if err := db.creditPoints(tx, order.UserID, bonus, models.LotSourceCampaign, order.Number); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
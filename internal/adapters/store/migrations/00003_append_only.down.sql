@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+DROP FUNCTION forbid_modification() CASCADE;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN TRANSACTION;
+
+CREATE OR REPLACE FUNCTION forbid_modification() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'table % is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMIT;
@@ -5,7 +5,9 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/rawen554/go-loyal/internal/models"
@@ -46,149 +48,613 @@ func (mr *MockStoreMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStore)(nil).Close))
 }
 
+// CreateAuditEvent mocks base method.
+func (m *MockStore) CreateAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuditEvent", ctx, e)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAuditEvent indicates an expected call of CreateAuditEvent.
+func (mr *MockStoreMockRecorder) CreateAuditEvent(ctx, e interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuditEvent", reflect.TypeOf((*MockStore)(nil).CreateAuditEvent), ctx, e)
+}
+
+// CreateBalanceAdjustment mocks base method.
+func (m *MockStore) CreateBalanceAdjustment(ctx context.Context, adj *models.BalanceAdjustment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBalanceAdjustment", ctx, adj)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateBalanceAdjustment indicates an expected call of CreateBalanceAdjustment.
+func (mr *MockStoreMockRecorder) CreateBalanceAdjustment(ctx, adj interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBalanceAdjustment", reflect.TypeOf((*MockStore)(nil).CreateBalanceAdjustment), ctx, adj)
+}
+
+// CreateCampaign mocks base method.
+func (m *MockStore) CreateCampaign(ctx context.Context, c *models.Campaign) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCampaign", ctx, c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateCampaign indicates an expected call of CreateCampaign.
+func (mr *MockStoreMockRecorder) CreateCampaign(ctx, c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCampaign", reflect.TypeOf((*MockStore)(nil).CreateCampaign), ctx, c)
+}
+
+// CreatePasswordResetToken mocks base method.
+func (m *MockStore) CreatePasswordResetToken(ctx context.Context, t *models.PasswordResetToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordResetToken", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordResetToken indicates an expected call of CreatePasswordResetToken.
+func (mr *MockStoreMockRecorder) CreatePasswordResetToken(ctx, t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordResetToken", reflect.TypeOf((*MockStore)(nil).CreatePasswordResetToken), ctx, t)
+}
+
+// CreateReferredUser mocks base method.
+func (m *MockStore) CreateReferredUser(ctx context.Context, user *models.User, referrerID uint64) (*models.Referral, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReferredUser", ctx, user, referrerID)
+	ret0, _ := ret[0].(*models.Referral)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateReferredUser indicates an expected call of CreateReferredUser.
+func (mr *MockStoreMockRecorder) CreateReferredUser(ctx, user, referrerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReferredUser", reflect.TypeOf((*MockStore)(nil).CreateReferredUser), ctx, user, referrerID)
+}
+
+// CreateTransfer mocks base method.
+func (m *MockStore) CreateTransfer(ctx context.Context, senderID uint64, t models.TransferSchema, idempotencyKey string) (*models.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTransfer", ctx, senderID, t, idempotencyKey)
+	ret0, _ := ret[0].(*models.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTransfer indicates an expected call of CreateTransfer.
+func (mr *MockStoreMockRecorder) CreateTransfer(ctx, senderID, t, idempotencyKey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransfer", reflect.TypeOf((*MockStore)(nil).CreateTransfer), ctx, senderID, t, idempotencyKey)
+}
+
 // CreateUser mocks base method.
-func (m *MockStore) CreateUser(user *models.User) (int64, error) {
+func (m *MockStore) CreateUser(ctx context.Context, user *models.User) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", user)
+	ret := m.ctrl.Call(m, "CreateUser", ctx, user)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateUser indicates an expected call of CreateUser.
-func (mr *MockStoreMockRecorder) CreateUser(user interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) CreateUser(ctx, user interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockStore)(nil).CreateUser), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockStore)(nil).CreateUser), ctx, user)
 }
 
 // CreateWithdraw mocks base method.
-func (m *MockStore) CreateWithdraw(userID uint64, w models.BalanceWithdrawShema) error {
+func (m *MockStore) CreateWithdraw(ctx context.Context, userID uint64, w models.BalanceWithdrawShema, status models.WithdrawStatus) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateWithdraw", userID, w)
+	ret := m.ctrl.Call(m, "CreateWithdraw", ctx, userID, w, status)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateWithdraw indicates an expected call of CreateWithdraw.
-func (mr *MockStoreMockRecorder) CreateWithdraw(userID, w interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) CreateWithdraw(ctx, userID, w, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWithdraw", reflect.TypeOf((*MockStore)(nil).CreateWithdraw), ctx, userID, w, status)
+}
+
+// DeferOrderLookup mocks base method.
+func (m *MockStore) DeferOrderLookup(ctx context.Context, number string, next time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeferOrderLookup", ctx, number, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeferOrderLookup indicates an expected call of DeferOrderLookup.
+func (mr *MockStoreMockRecorder) DeferOrderLookup(ctx, number, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeferOrderLookup", reflect.TypeOf((*MockStore)(nil).DeferOrderLookup), ctx, number, next)
+}
+
+// DeleteLoginAttempt mocks base method.
+func (m *MockStore) DeleteLoginAttempt(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLoginAttempt", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLoginAttempt indicates an expected call of DeleteLoginAttempt.
+func (mr *MockStoreMockRecorder) DeleteLoginAttempt(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLoginAttempt", reflect.TypeOf((*MockStore)(nil).DeleteLoginAttempt), ctx, key)
+}
+
+// DisableCampaign mocks base method.
+func (m *MockStore) DisableCampaign(ctx context.Context, id uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableCampaign", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableCampaign indicates an expected call of DisableCampaign.
+func (mr *MockStoreMockRecorder) DisableCampaign(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableCampaign", reflect.TypeOf((*MockStore)(nil).DisableCampaign), ctx, id)
+}
+
+// DisableUserTOTP mocks base method.
+func (m *MockStore) DisableUserTOTP(ctx context.Context, userID uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableUserTOTP", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableUserTOTP indicates an expected call of DisableUserTOTP.
+func (mr *MockStoreMockRecorder) DisableUserTOTP(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableUserTOTP", reflect.TypeOf((*MockStore)(nil).DisableUserTOTP), ctx, userID)
+}
+
+// EnableUserTOTP mocks base method.
+func (m *MockStore) EnableUserTOTP(ctx context.Context, userID uint64, step int64, recoveryCodeHashes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableUserTOTP", ctx, userID, step, recoveryCodeHashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableUserTOTP indicates an expected call of EnableUserTOTP.
+func (mr *MockStoreMockRecorder) EnableUserTOTP(ctx, userID, step, recoveryCodeHashes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableUserTOTP", reflect.TypeOf((*MockStore)(nil).EnableUserTOTP), ctx, userID, step, recoveryCodeHashes)
+}
+
+// ExpirePoints mocks base method.
+func (m *MockStore) ExpirePoints(ctx context.Context, now time.Time) (float64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpirePoints", ctx, now)
+	ret0, _ := ret[0].(float64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpirePoints indicates an expected call of ExpirePoints.
+func (mr *MockStoreMockRecorder) ExpirePoints(ctx, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpirePoints", reflect.TypeOf((*MockStore)(nil).ExpirePoints), ctx, now)
+}
+
+// FlagOrderForReview mocks base method.
+func (m *MockStore) FlagOrderForReview(ctx context.Context, number string, reason models.ReviewReason) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FlagOrderForReview", ctx, number, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FlagOrderForReview indicates an expected call of FlagOrderForReview.
+func (mr *MockStoreMockRecorder) FlagOrderForReview(ctx, number, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FlagOrderForReview", reflect.TypeOf((*MockStore)(nil).FlagOrderForReview), ctx, number, reason)
+}
+
+// GetAuditEvents mocks base method.
+func (m *MockStore) GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditEvents", ctx, filter)
+	ret0, _ := ret[0].([]models.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditEvents indicates an expected call of GetAuditEvents.
+func (mr *MockStoreMockRecorder) GetAuditEvents(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditEvents", reflect.TypeOf((*MockStore)(nil).GetAuditEvents), ctx, filter)
+}
+
+// GetBalanceAdjustments mocks base method.
+func (m *MockStore) GetBalanceAdjustments(ctx context.Context, userID uint64) ([]models.BalanceAdjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceAdjustments", ctx, userID)
+	ret0, _ := ret[0].([]models.BalanceAdjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceAdjustments indicates an expected call of GetBalanceAdjustments.
+func (mr *MockStoreMockRecorder) GetBalanceAdjustments(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceAdjustments", reflect.TypeOf((*MockStore)(nil).GetBalanceAdjustments), ctx, userID)
+}
+
+// GetBalanceHistory mocks base method.
+func (m *MockStore) GetBalanceHistory(ctx context.Context, userID uint64) ([]models.BalanceHistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceHistory", ctx, userID)
+	ret0, _ := ret[0].([]models.BalanceHistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceHistory indicates an expected call of GetBalanceHistory.
+func (mr *MockStoreMockRecorder) GetBalanceHistory(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceHistory", reflect.TypeOf((*MockStore)(nil).GetBalanceHistory), ctx, userID)
+}
+
+// GetCampaigns mocks base method.
+func (m *MockStore) GetCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaigns", ctx)
+	ret0, _ := ret[0].([]models.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaigns indicates an expected call of GetCampaigns.
+func (mr *MockStoreMockRecorder) GetCampaigns(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWithdraw", reflect.TypeOf((*MockStore)(nil).CreateWithdraw), userID, w)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaigns", reflect.TypeOf((*MockStore)(nil).GetCampaigns), ctx)
+}
+
+// GetLoginAttempt mocks base method.
+func (m *MockStore) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginAttempt", ctx, key)
+	ret0, _ := ret[0].(*models.LoginAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginAttempt indicates an expected call of GetLoginAttempt.
+func (mr *MockStoreMockRecorder) GetLoginAttempt(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginAttempt", reflect.TypeOf((*MockStore)(nil).GetLoginAttempt), ctx, key)
+}
+
+// GetOrder mocks base method.
+func (m *MockStore) GetOrder(ctx context.Context, number string) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrder", ctx, number)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder.
+func (mr *MockStoreMockRecorder) GetOrder(ctx, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockStore)(nil).GetOrder), ctx, number)
+}
+
+// GetOrdersForReview mocks base method.
+func (m *MockStore) GetOrdersForReview(ctx context.Context) ([]models.ReviewOrderSchema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrdersForReview", ctx)
+	ret0, _ := ret[0].([]models.ReviewOrderSchema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrdersForReview indicates an expected call of GetOrdersForReview.
+func (mr *MockStoreMockRecorder) GetOrdersForReview(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersForReview", reflect.TypeOf((*MockStore)(nil).GetOrdersForReview), ctx)
+}
+
+// GetPendingWithdrawals mocks base method.
+func (m *MockStore) GetPendingWithdrawals(ctx context.Context) ([]models.PendingWithdrawSchema, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingWithdrawals", ctx)
+	ret0, _ := ret[0].([]models.PendingWithdrawSchema)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPendingWithdrawals indicates an expected call of GetPendingWithdrawals.
+func (mr *MockStoreMockRecorder) GetPendingWithdrawals(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingWithdrawals", reflect.TypeOf((*MockStore)(nil).GetPendingWithdrawals), ctx)
+}
+
+// GetReferrals mocks base method.
+func (m *MockStore) GetReferrals(ctx context.Context, referrerID uint64) ([]models.Referral, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReferrals", ctx, referrerID)
+	ret0, _ := ret[0].([]models.Referral)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReferrals indicates an expected call of GetReferrals.
+func (mr *MockStoreMockRecorder) GetReferrals(ctx, referrerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReferrals", reflect.TypeOf((*MockStore)(nil).GetReferrals), ctx, referrerID)
 }
 
 // GetUnprocessedOrders mocks base method.
-func (m *MockStore) GetUnprocessedOrders() ([]models.Order, error) {
+func (m *MockStore) GetUnprocessedOrders(ctx context.Context) ([]models.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUnprocessedOrders")
+	ret := m.ctrl.Call(m, "GetUnprocessedOrders", ctx)
 	ret0, _ := ret[0].([]models.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUnprocessedOrders indicates an expected call of GetUnprocessedOrders.
-func (mr *MockStoreMockRecorder) GetUnprocessedOrders() *gomock.Call {
+func (mr *MockStoreMockRecorder) GetUnprocessedOrders(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnprocessedOrders", reflect.TypeOf((*MockStore)(nil).GetUnprocessedOrders))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnprocessedOrders", reflect.TypeOf((*MockStore)(nil).GetUnprocessedOrders), ctx)
 }
 
 // GetUser mocks base method.
-func (m *MockStore) GetUser(u *models.User) (*models.User, error) {
+func (m *MockStore) GetUser(ctx context.Context, u *models.User) (*models.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUser", u)
+	ret := m.ctrl.Call(m, "GetUser", ctx, u)
 	ret0, _ := ret[0].(*models.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUser indicates an expected call of GetUser.
-func (mr *MockStoreMockRecorder) GetUser(u interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetUser(ctx, u interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStore)(nil).GetUser), u)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStore)(nil).GetUser), ctx, u)
 }
 
 // GetUserBalance mocks base method.
-func (m *MockStore) GetUserBalance(userID uint64) (*models.UserBalanceShema, error) {
+func (m *MockStore) GetUserBalance(ctx context.Context, userID uint64) (*models.UserBalanceShema, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserBalance", userID)
+	ret := m.ctrl.Call(m, "GetUserBalance", ctx, userID)
 	ret0, _ := ret[0].(*models.UserBalanceShema)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserBalance indicates an expected call of GetUserBalance.
-func (mr *MockStoreMockRecorder) GetUserBalance(userID interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetUserBalance(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserBalance", reflect.TypeOf((*MockStore)(nil).GetUserBalance), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserBalance", reflect.TypeOf((*MockStore)(nil).GetUserBalance), ctx, userID)
 }
 
 // GetUserOrders mocks base method.
-func (m *MockStore) GetUserOrders(userID uint64) ([]models.Order, error) {
+func (m *MockStore) GetUserOrders(ctx context.Context, userID uint64) ([]models.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserOrders", userID)
+	ret := m.ctrl.Call(m, "GetUserOrders", ctx, userID)
 	ret0, _ := ret[0].([]models.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserOrders indicates an expected call of GetUserOrders.
-func (mr *MockStoreMockRecorder) GetUserOrders(userID interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetUserOrders(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserOrders", reflect.TypeOf((*MockStore)(nil).GetUserOrders), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserOrders", reflect.TypeOf((*MockStore)(nil).GetUserOrders), ctx, userID)
 }
 
 // GetWithdrawals mocks base method.
-func (m *MockStore) GetWithdrawals(userID uint64) ([]models.Withdraw, error) {
+func (m *MockStore) GetWithdrawals(ctx context.Context, userID uint64) ([]models.Withdraw, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetWithdrawals", userID)
+	ret := m.ctrl.Call(m, "GetWithdrawals", ctx, userID)
 	ret0, _ := ret[0].([]models.Withdraw)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetWithdrawals indicates an expected call of GetWithdrawals.
-func (mr *MockStoreMockRecorder) GetWithdrawals(userID interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetWithdrawals(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockStore)(nil).GetWithdrawals), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockStore)(nil).GetWithdrawals), ctx, userID)
 }
 
 // Ping mocks base method.
-func (m *MockStore) Ping() error {
+func (m *MockStore) Ping(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Ping")
+	ret := m.ctrl.Call(m, "Ping", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Ping indicates an expected call of Ping.
-func (mr *MockStoreMockRecorder) Ping() *gomock.Call {
+func (mr *MockStoreMockRecorder) Ping(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStore)(nil).Ping))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStore)(nil).Ping), ctx)
 }
 
 // PutOrder mocks base method.
-func (m *MockStore) PutOrder(number string, userID uint64) error {
+func (m *MockStore) PutOrder(ctx context.Context, number string, userID uint64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PutOrder", number, userID)
+	ret := m.ctrl.Call(m, "PutOrder", ctx, number, userID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // PutOrder indicates an expected call of PutOrder.
-func (mr *MockStoreMockRecorder) PutOrder(number, userID interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) PutOrder(ctx, number, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutOrder", reflect.TypeOf((*MockStore)(nil).PutOrder), ctx, number, userID)
+}
+
+// RequeueOrder mocks base method.
+func (m *MockStore) RequeueOrder(ctx context.Context, number string) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueOrder", ctx, number)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequeueOrder indicates an expected call of RequeueOrder.
+func (mr *MockStoreMockRecorder) RequeueOrder(ctx, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueOrder", reflect.TypeOf((*MockStore)(nil).RequeueOrder), ctx, number)
+}
+
+// ResetUserPassword mocks base method.
+func (m *MockStore) ResetUserPassword(ctx context.Context, tokenHash, hash string) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetUserPassword", ctx, tokenHash, hash)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetUserPassword indicates an expected call of ResetUserPassword.
+func (mr *MockStoreMockRecorder) ResetUserPassword(ctx, tokenHash, hash interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutOrder", reflect.TypeOf((*MockStore)(nil).PutOrder), number, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetUserPassword", reflect.TypeOf((*MockStore)(nil).ResetUserPassword), ctx, tokenHash, hash)
+}
+
+// ResolveWithdrawal mocks base method.
+func (m *MockStore) ResolveWithdrawal(ctx context.Context, id uint64, approve bool) (*models.Withdraw, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveWithdrawal", ctx, id, approve)
+	ret0, _ := ret[0].(*models.Withdraw)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveWithdrawal indicates an expected call of ResolveWithdrawal.
+func (mr *MockStoreMockRecorder) ResolveWithdrawal(ctx, id, approve interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveWithdrawal", reflect.TypeOf((*MockStore)(nil).ResolveWithdrawal), ctx, id, approve)
+}
+
+// SetUserRole mocks base method.
+func (m *MockStore) SetUserRole(ctx context.Context, userID uint64, role models.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", ctx, userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockStoreMockRecorder) SetUserRole(ctx, userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockStore)(nil).SetUserRole), ctx, userID, role)
+}
+
+// SetUserTOTPSecret mocks base method.
+func (m *MockStore) SetUserTOTPSecret(ctx context.Context, userID uint64, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserTOTPSecret", ctx, userID, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserTOTPSecret indicates an expected call of SetUserTOTPSecret.
+func (mr *MockStoreMockRecorder) SetUserTOTPSecret(ctx, userID, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserTOTPSecret", reflect.TypeOf((*MockStore)(nil).SetUserTOTPSecret), ctx, userID, secret)
+}
+
+// UpdateLoginAttempt mocks base method.
+func (m *MockStore) UpdateLoginAttempt(ctx context.Context, key string, update func(*models.LoginAttempt)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLoginAttempt", ctx, key, update)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateLoginAttempt indicates an expected call of UpdateLoginAttempt.
+func (mr *MockStoreMockRecorder) UpdateLoginAttempt(ctx, key, update interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLoginAttempt", reflect.TypeOf((*MockStore)(nil).UpdateLoginAttempt), ctx, key, update)
 }
 
 // UpdateOrder mocks base method.
-func (m *MockStore) UpdateOrder(o *models.Order) (int64, error) {
+func (m *MockStore) UpdateOrder(ctx context.Context, o *models.Order) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateOrder", o)
+	ret := m.ctrl.Call(m, "UpdateOrder", ctx, o)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateOrder indicates an expected call of UpdateOrder.
-func (mr *MockStoreMockRecorder) UpdateOrder(o interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) UpdateOrder(ctx, o interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockStore)(nil).UpdateOrder), ctx, o)
+}
+
+// UpdateUserPassword mocks base method.
+func (m *MockStore) UpdateUserPassword(ctx context.Context, userID uint64, hash string) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPassword", ctx, userID, hash)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUserPassword indicates an expected call of UpdateUserPassword.
+func (mr *MockStoreMockRecorder) UpdateUserPassword(ctx, userID, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPassword", reflect.TypeOf((*MockStore)(nil).UpdateUserPassword), ctx, userID, hash)
+}
+
+// UpdateUserPasswordHash mocks base method.
+func (m *MockStore) UpdateUserPasswordHash(ctx context.Context, userID uint64, hash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPasswordHash", ctx, userID, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserPasswordHash indicates an expected call of UpdateUserPasswordHash.
+func (mr *MockStoreMockRecorder) UpdateUserPasswordHash(ctx, userID, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPasswordHash", reflect.TypeOf((*MockStore)(nil).UpdateUserPasswordHash), ctx, userID, hash)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockStore) UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, userID, codeHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStoreMockRecorder) UseRecoveryCode(ctx, userID, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStore)(nil).UseRecoveryCode), ctx, userID, codeHash)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStore) UseTOTPStep(ctx context.Context, userID uint64, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, userID, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStoreMockRecorder) UseTOTPStep(ctx, userID, step interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockStore)(nil).UpdateOrder), o)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStore)(nil).UseTOTPStep), ctx, userID, step)
 }
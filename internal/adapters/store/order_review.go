@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeferOrderLookup postpones the next accrual lookup of a pending order until next.
+func (db *DBStore) DeferOrderLookup(ctx context.Context, number string, next time.Time) error {
+	result := db.conn.WithContext(ctx).Model(&models.Order{}).
+		Where("number = ? AND status IN ?", number, models.PendingStatuses).
+		Updates(map[string]interface{}{
+			"next_lookup_at":  next,
+			"lookup_attempts": gorm.Expr("lookup_attempts + 1"),
+		})
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error deferring order lookup: %w", err)
+	}
+
+	return nil
+}
+
+// FlagOrderForReview takes a pending order out of processing until it is requeued.
+func (db *DBStore) FlagOrderForReview(ctx context.Context, number string, reason models.ReviewReason) error {
+	result := db.conn.WithContext(ctx).Model(&models.Order{}).
+		Where("number = ? AND status IN ?", number, models.PendingStatuses).
+		Update("review_reason", reason)
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error flagging order for review: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStore) GetOrdersForReview(ctx context.Context) ([]models.ReviewOrderSchema, error) {
+	orders := make([]models.ReviewOrderSchema, 0)
+	result := db.conn.WithContext(ctx).Model(&models.Order{}).
+		Where("review_reason <> ''").
+		Order("uploaded_at asc").
+		Find(&orders)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting orders for review: %w", err)
+	}
+
+	if len(orders) == 0 {
+		return nil, models.ErrUserHasNoItems
+	}
+
+	return orders, nil
+}
+
+// RequeueOrder clears the review flag so that the order is looked up in accrual again from scratch.
+func (db *DBStore) RequeueOrder(ctx context.Context, number string) (*models.Order, error) {
+	var order models.Order
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(&models.Order{Number: number}).
+			Limit(1).
+			Find(&order)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error getting order: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderNotFound
+		}
+		if order.ReviewReason == "" {
+			return ErrOrderNotInReview
+		}
+
+		order.ReviewReason = ""
+		order.LookupAttempts = 0
+		order.NextLookupAt = nil
+		err := tx.Model(&order).Updates(map[string]interface{}{
+			"review_reason":   order.ReviewReason,
+			"lookup_attempts": order.LookupAttempts,
+			"next_lookup_at":  order.NextLookupAt,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("error updating order: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("order not requeued: %w", err)
+	}
+
+	return &order, nil
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockUser locks the user row until the end of tx, so balance checks and updates do not race.
+func lockUser(tx *gorm.DB, userID uint64) (*models.User, error) {
+	var u models.User
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Limit(1).Find(&u, userID)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error locking user: %w", err)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, models.ErrLoginNotFound
+	}
+
+	return &u, nil
+}
+
+// lockUsers locks several users in id order, so transactions locking the same users do not deadlock.
+func lockUsers(tx *gorm.DB, userIDs ...uint64) (map[uint64]*models.User, error) {
+	sorted := append([]uint64(nil), userIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	locked := make(map[uint64]*models.User, len(sorted))
+	for _, id := range sorted {
+		if _, ok := locked[id]; ok {
+			continue
+		}
+		u, err := lockUser(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		locked[id] = u
+	}
+
+	return locked, nil
+}
+
+// creditPoints adds amount to the user's balance as a new lot expiring after the points lifetime.
+func (db *DBStore) creditPoints(
+	tx *gorm.DB,
+	userID uint64,
+	amount float64,
+	source models.LotSource,
+	reference string,
+) error {
+	return db.creditLot(tx, userID, amount, source, reference, time.Now().AddDate(0, db.points.LifetimeMonths, 0))
+}
+
+func (db *DBStore) creditLot(
+	tx *gorm.DB,
+	userID uint64,
+	amount float64,
+	source models.LotSource,
+	reference string,
+	expiresAt time.Time,
+) error {
+	result := tx.Model(&models.User{}).Where("id = ?", userID).Update("balance", gorm.Expr("balance + ?", amount))
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error crediting user balance: %w", err)
+	}
+
+	return createLot(tx, userID, amount, source, reference, expiresAt)
+}
+
+// createLot records a lot for points already added to the user's balance.
+func createLot(
+	tx *gorm.DB,
+	userID uint64,
+	amount float64,
+	source models.LotSource,
+	reference string,
+	expiresAt time.Time,
+) error {
+	lot := models.AccrualLot{
+		UserID:    userID,
+		Source:    source,
+		Reference: reference,
+		Amount:    amount,
+		Remaining: amount,
+		ExpiresAt: expiresAt,
+	}
+	if err := tx.Create(&lot).Error; err != nil {
+		return fmt.Errorf("error creating accrual lot: %w", err)
+	}
+
+	return nil
+}
+
+// debitPoints consumes amount from the user's lots, soonest expiring first.
+// The balance itself is updated by the caller, which must hold the user lock.
+func debitPoints(tx *gorm.DB, userID uint64, amount float64) error {
+	_, err := debitLots(tx, userID, amount)
+	return err
+}
+
+// debitLots is debitPoints returning the consumed parts of the lots.
+func debitLots(tx *gorm.DB, userID uint64, amount float64) ([]models.AccrualLot, error) {
+	lots := make([]models.AccrualLot, 0)
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND remaining > 0", userID).
+		Order("expires_at asc, id asc").
+		Find(&lots)
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting accrual lots: %w", err)
+	}
+
+	consumed := make([]models.AccrualLot, 0, len(lots))
+	left := amount
+	for i := range lots {
+		if left <= 0 {
+			break
+		}
+
+		take := math.Min(lots[i].Remaining, left)
+		if err := tx.Model(&lots[i]).Update("remaining", gorm.Expr("remaining - ?", take)).Error; err != nil {
+			return nil, fmt.Errorf("error consuming accrual lot: %w", err)
+		}
+		left -= take
+
+		part := lots[i]
+		part.Remaining = take
+		consumed = append(consumed, part)
+	}
+
+	return consumed, nil
+}
+
+func (db *DBStore) getExpiringPoints(
+	ctx context.Context,
+	userID uint64,
+	before time.Time,
+) ([]models.ExpiringPoints, error) {
+	expiring := make([]models.ExpiringPoints, 0)
+	result := db.conn.WithContext(ctx).Model(&models.AccrualLot{}).
+		Select("date_trunc('day', expires_at) AS expires_at, SUM(remaining) AS amount").
+		Where("user_id = ? AND remaining > 0 AND expires_at <= ?", userID, before).
+		Group("date_trunc('day', expires_at)").
+		Order("expires_at asc").
+		Scan(&expiring)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting expiring points: %w", err)
+	}
+
+	return expiring, nil
+}
+
+// ExpirePoints writes off the remainders of lots expired by now and returns the total amount expired.
+func (db *DBStore) ExpirePoints(ctx context.Context, now time.Time) (float64, error) {
+	userIDs := make([]uint64, 0)
+	result := db.conn.WithContext(ctx).Model(&models.AccrualLot{}).
+		Where("expires_at <= ? AND remaining > 0", now).
+		Distinct().
+		Pluck("user_id", &userIDs)
+	if err := result.Error; err != nil {
+		return 0, fmt.Errorf("error getting users with expired points: %w", err)
+	}
+
+	var total float64
+	for _, userID := range userIDs {
+		expired, err := db.expireUserPoints(ctx, userID, now)
+		if err != nil {
+			return total, err
+		}
+		total += expired
+	}
+
+	return total, nil
+}
+
+func (db *DBStore) expireUserPoints(ctx context.Context, userID uint64, now time.Time) (float64, error) {
+	var total float64
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		lots := make([]models.AccrualLot, 0)
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND expires_at <= ? AND remaining > 0", userID, now).
+			Find(&lots)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error getting expired lots: %w", err)
+		}
+
+		for i := range lots {
+			// Update below zeroes lots[i].Remaining as well.
+			amount := lots[i].Remaining
+			if err := tx.Create(&models.PointsExpiration{
+				UserID: userID,
+				LotID:  lots[i].ID,
+				Amount: amount,
+			}).Error; err != nil {
+				return fmt.Errorf("error recording points expiration: %w", err)
+			}
+
+			if err := tx.Model(&lots[i]).Update("remaining", 0).Error; err != nil {
+				return fmt.Errorf("error closing expired lot: %w", err)
+			}
+			total += amount
+		}
+
+		result = tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("balance", gorm.Expr("GREATEST(balance - ?, 0)", total))
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error writing off expired points: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("points expiration not commited: %w", err)
+	}
+
+	return total, nil
+}
+
+// backfillLots covers balances accrued before lots existed with a single legacy lot per user.
+func (db *DBStore) backfillLots(ctx context.Context) error {
+	result := db.conn.WithContext(ctx).Exec(`
+INSERT INTO accrual_lots (user_id, source, amount, remaining, accrued_at, expires_at)
+SELECT u.id, @source, u.balance - COALESCE(l.remaining, 0), u.balance - COALESCE(l.remaining, 0),
+	now(), now() + make_interval(months => @months)
+FROM users u
+LEFT JOIN (SELECT user_id, SUM(remaining) AS remaining FROM accrual_lots GROUP BY user_id) l ON l.user_id = u.id
+WHERE u.balance > COALESCE(l.remaining, 0)`,
+		map[string]interface{}{"source": models.LotSourceLegacy, "months": db.points.LifetimeMonths},
+	)
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error backfilling accrual lots: %w", err)
+	}
+
+	return nil
+}
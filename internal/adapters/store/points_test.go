@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpirePointsDebitsBalance(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	u := newTestUser(t, db)
+
+	for _, amount := range []float64{100, -40} {
+		err := db.CreateBalanceAdjustment(ctx, &models.BalanceAdjustment{
+			UserID:     u.ID,
+			Amount:     amount,
+			ReasonCode: models.ReasonCorrection,
+		})
+		require.NoError(t, err)
+	}
+
+	balance, err := db.GetUserBalance(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, 60.0, balance.Balance)
+
+	expired, err := db.ExpirePoints(ctx, time.Now().AddDate(0, db.points.LifetimeMonths+1, 0))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, expired, 60.0)
+
+	balance, err = db.GetUserBalance(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, 0.0, balance.Balance)
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReferralPolicy struct {
+	// Bonus is credited to the referrer on the referee's first processed order.
+	Bonus float64
+}
+
+func WithReferralPolicy(policy ReferralPolicy) Option {
+	return func(db *DBStore) {
+		db.referrals = policy
+	}
+}
+
+// CreateReferredUser creates the user together with the referral linking them to the referrer, so a user
+// is never registered without the referral. Referrals that look fraudulent are stored rejected,
+// so they are visible to the referrer but never rewarded.
+func (db *DBStore) CreateReferredUser(
+	ctx context.Context,
+	user *models.User,
+	referrerID uint64,
+) (*models.Referral, error) {
+	var referral models.Referral
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := createUser(tx, user); err != nil {
+			return err
+		}
+
+		referral = models.Referral{
+			ReferrerID: referrerID,
+			RefereeID:  user.ID,
+			Status:     models.ReferralPending,
+		}
+
+		reason, err := referralRejectReason(tx, referrerID, user.RegistrationIP)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			referral.Status = models.ReferralRejected
+			referral.RejectReason = reason
+		}
+
+		if err := tx.Create(&referral).Error; err != nil {
+			return fmt.Errorf("error creating referral: %w", err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("referred user not created: %w", err)
+	}
+
+	return &referral, nil
+}
+
+// referralRejectReason returns why the referral looks like the referrer inviting themselves, empty if it does not.
+// The referee is always a just created account, so a self-referral only shows in the IP it comes from.
+func referralRejectReason(tx *gorm.DB, referrerID uint64, ip string) (string, error) {
+	if ip == "" {
+		return "", nil
+	}
+
+	var referrer models.User
+	result := tx.Limit(1).Find(&referrer, referrerID)
+	if err := result.Error; err != nil {
+		return "", fmt.Errorf("error getting referrer: %w", err)
+	}
+	if result.RowsAffected == 0 {
+		return "", models.ErrLoginNotFound
+	}
+	if referrer.RegistrationIP == ip {
+		return models.ReferralRejectSameIP, nil
+	}
+
+	var seen int64
+	result = tx.Model(&models.AuditEvent{}).
+		Where("actor_id = ? AND ip = ?", referrerID, ip).
+		Limit(1).
+		Count(&seen)
+	if err := result.Error; err != nil {
+		return "", fmt.Errorf("error checking referrer ip: %w", err)
+	}
+	if seen > 0 {
+		return models.ReferralRejectSameIP, nil
+	}
+
+	return "", nil
+}
+
+func (db *DBStore) GetReferrals(ctx context.Context, referrerID uint64) ([]models.Referral, error) {
+	referrals := make([]models.Referral, 0)
+	result := db.conn.WithContext(ctx).Model(&models.Referral{}).
+		Select("referrals.*, users.login AS referee_login").
+		Joins("JOIN users ON users.id = referrals.referee_id").
+		Where("referrals.referrer_id = ?", referrerID).
+		Order("referrals.created_at asc").
+		Find(&referrals)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting referrals: %w", err)
+	}
+
+	return referrals, nil
+}
+
+// pendingReferral returns the locked pending referral of the referee, nil if there is none.
+func pendingReferral(tx *gorm.DB, refereeID uint64) (*models.Referral, error) {
+	var referral models.Referral
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("referee_id = ? AND status = ?", refereeID, models.ReferralPending).
+		Limit(1).
+		Find(&referral)
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting referral: %w", err)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil //nolint:nilnil // no pending referral is not an error
+	}
+
+	return &referral, nil
+}
+
+// rewardReferral credits the referral bonus to the referrer. The caller must hold the referrer lock.
+func (db *DBStore) rewardReferral(tx *gorm.DB, referral *models.Referral) error {
+	if db.referrals.Bonus <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	result := tx.Model(referral).Updates(models.Referral{
+		Status:     models.ReferralRewarded,
+		RewardedAt: &now,
+		Bonus:      db.referrals.Bonus,
+	})
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error rewarding referral: %w", err)
+	}
+
+	return db.creditPoints(tx, referral.ReferrerID, db.referrals.Bonus, models.LotSourceReferral, fmt.Sprint(referral.ID))
+}
+
+// backfillReferralCodes gives referral codes to users registered before referrals existed.
+func (db *DBStore) backfillReferralCodes(ctx context.Context) error {
+	result := db.conn.WithContext(ctx).Exec(`
+UPDATE users SET referral_code = upper(substr(md5(random()::text || id::text), 1, 8))
+WHERE referral_code IS NULL`)
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error backfilling referral codes: %w", err)
+	}
+
+	return nil
+}
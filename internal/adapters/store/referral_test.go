@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateReferredUser(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	referrer := newTestUser(t, db)
+
+	referee := &models.User{Login: referrer.Login + "-referee", Password: "-", RegistrationIP: "192.0.2.1"}
+	referral, err := db.CreateReferredUser(ctx, referee, referrer.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.ReferralPending, referral.Status)
+	require.Equal(t, referee.ID, referral.RefereeID)
+
+	// A failed registration leaves neither the user nor the referral behind.
+	duplicate := &models.User{Login: referee.Login, Password: "-"}
+	_, err = db.CreateReferredUser(ctx, duplicate, referrer.ID)
+	require.ErrorIs(t, err, ErrDuplicateLogin)
+
+	referrals, err := db.GetReferrals(ctx, referrer.ID)
+	require.NoError(t, err)
+	require.Len(t, referrals, 1)
+}
+
+func TestCreateReferredUserSameIP(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+
+	login := fmt.Sprintf("%v-%v", t.Name(), time.Now().UnixNano())
+	referrer := &models.User{Login: login, Password: "-", RegistrationIP: "192.0.2.2"}
+	_, err := db.CreateUser(ctx, referrer)
+	require.NoError(t, err)
+
+	referee := &models.User{Login: login + "-referee", Password: "-", RegistrationIP: referrer.RegistrationIP}
+	referral, err := db.CreateReferredUser(ctx, referee, referrer.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.ReferralRejected, referral.Status)
+	require.Equal(t, models.ReferralRejectSameIP, referral.RejectReason)
+}
@@ -18,24 +18,80 @@ import (
 	"github.com/rawen554/go-loyal/internal/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
 type DBStore struct {
-	conn *gorm.DB
+	conn        *gorm.DB
+	points      PointsPolicy
+	tiers       TierPolicy
+	transfers   TransferPolicy
+	referrals   ReferralPolicy
+	withdrawals WithdrawPolicy
+}
+
+type PointsPolicy struct {
+	LifetimeMonths     int
+	ExpiringSoonWindow time.Duration
+}
+
+type Option func(*DBStore)
+
+func WithPointsPolicy(policy PointsPolicy) Option {
+	return func(db *DBStore) {
+		db.points = policy
+	}
 }
 
 type Store interface {
-	CreateUser(user *models.User) (int64, error)
-	GetUser(u *models.User) (*models.User, error)
-	PutOrder(number string, userID uint64) error
-	UpdateOrder(o *models.Order) (int64, error)
-	GetUserOrders(userID uint64) ([]models.Order, error)
-	GetUnprocessedOrders() ([]models.Order, error)
-	GetUserBalance(userID uint64) (*models.UserBalanceShema, error)
-	CreateWithdraw(userID uint64, w models.BalanceWithdrawShema) error
-	GetWithdrawals(userID uint64) ([]models.Withdraw, error)
-	Ping() error
+	CreateUser(ctx context.Context, user *models.User) (int64, error)
+	GetUser(ctx context.Context, u *models.User) (*models.User, error)
+	UpdateUserPassword(ctx context.Context, userID uint64, hash string) (*models.User, error)
+	UpdateUserPasswordHash(ctx context.Context, userID uint64, hash string) error
+	CreatePasswordResetToken(ctx context.Context, t *models.PasswordResetToken) error
+	ResetUserPassword(ctx context.Context, tokenHash string, hash string) (*models.User, error)
+	SetUserTOTPSecret(ctx context.Context, userID uint64, secret string) error
+	EnableUserTOTP(ctx context.Context, userID uint64, step int64, recoveryCodeHashes []string) error
+	DisableUserTOTP(ctx context.Context, userID uint64) error
+	UseTOTPStep(ctx context.Context, userID uint64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) error
+	SetUserRole(ctx context.Context, userID uint64, role models.Role) error
+	CreateBalanceAdjustment(ctx context.Context, adj *models.BalanceAdjustment) error
+	GetBalanceAdjustments(ctx context.Context, userID uint64) ([]models.BalanceAdjustment, error)
+	GetBalanceHistory(ctx context.Context, userID uint64) ([]models.BalanceHistoryEntry, error)
+	CreateAuditEvent(ctx context.Context, e *models.AuditEvent) error
+	GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+	PutOrder(ctx context.Context, number string, userID uint64) error
+	UpdateOrder(ctx context.Context, o *models.Order) (int64, error)
+	GetOrder(ctx context.Context, number string) (*models.Order, error)
+	GetUserOrders(ctx context.Context, userID uint64) ([]models.Order, error)
+	GetUnprocessedOrders(ctx context.Context) ([]models.Order, error)
+	DeferOrderLookup(ctx context.Context, number string, next time.Time) error
+	FlagOrderForReview(ctx context.Context, number string, reason models.ReviewReason) error
+	GetOrdersForReview(ctx context.Context) ([]models.ReviewOrderSchema, error)
+	RequeueOrder(ctx context.Context, number string) (*models.Order, error)
+	GetUserBalance(ctx context.Context, userID uint64) (*models.UserBalanceShema, error)
+	ExpirePoints(ctx context.Context, now time.Time) (float64, error)
+	CreateCampaign(ctx context.Context, c *models.Campaign) error
+	GetCampaigns(ctx context.Context) ([]models.Campaign, error)
+	DisableCampaign(ctx context.Context, id uint64) error
+	CreateReferredUser(ctx context.Context, user *models.User, referrerID uint64) (*models.Referral, error)
+	GetReferrals(ctx context.Context, referrerID uint64) ([]models.Referral, error)
+	CreateWithdraw(ctx context.Context, userID uint64, w models.BalanceWithdrawShema, status models.WithdrawStatus) error
+	GetPendingWithdrawals(ctx context.Context) ([]models.PendingWithdrawSchema, error)
+	ResolveWithdrawal(ctx context.Context, id uint64, approve bool) (*models.Withdraw, error)
+	CreateTransfer(
+		ctx context.Context,
+		senderID uint64,
+		t models.TransferSchema,
+		idempotencyKey string,
+	) (*models.Transfer, error)
+	GetWithdrawals(ctx context.Context, userID uint64) ([]models.Withdraw, error)
+	GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error)
+	UpdateLoginAttempt(ctx context.Context, key string, update func(a *models.LoginAttempt)) error
+	DeleteLoginAttempt(ctx context.Context, key string) error
+	Ping(ctx context.Context) error
 	Close()
 }
 
@@ -46,13 +102,26 @@ const (
 
 var ErrDBInsertConflict = errors.New("conflict insert into table, returned stored value")
 var ErrURLDeleted = errors.New("url is deleted")
-var ErrLoginNotFound = errors.New("login not found")
 var ErrDuplicateLogin = errors.New("login already registered")
 var ErrNotEnoughAmount = errors.New("not enough balance")
+var ErrResetTokenNotValid = errors.New("password reset token is not valid")
+var ErrTOTPCodeReused = errors.New("totp code has already been used")
+var ErrRecoveryCodeNotValid = errors.New("recovery code is not valid")
+var ErrSelfTransfer = errors.New("cannot transfer points to yourself")
+var ErrTransferLimitExceeded = errors.New("daily transfer limit exceeded")
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with another request")
+var ErrWithdrawNotFound = errors.New("withdrawal not found")
+var ErrWithdrawNotPending = errors.New("withdrawal is not pending")
+var ErrOrderNotFound = errors.New("order not found")
+var ErrOrderNotInReview = errors.New("order is not flagged for review")
 
-const connectTick = 5
+const (
+	connectTick           = 5
+	defaultLifetimeMonths = 12
+	defaultExpiringSoon   = 30 * 24 * time.Hour
+)
 
-func NewStore(ctx context.Context, dsn string, logLevel string) (Store, error) {
+func NewStore(ctx context.Context, dsn string, logLevel string, opts ...Option) (Store, error) {
 	conn, err := ConnectLoop(dsn, connectTick*time.Second, time.Minute)
 	if err != nil {
 		return nil, err
@@ -67,13 +136,59 @@ func NewStore(ctx context.Context, dsn string, logLevel string) (Store, error) {
 	}
 
 	conn.Logger = logger.Default.LogMode(logger.LogLevel(utils.ConvertLogLevelToInt(logLevel)))
-	if err := conn.AutoMigrate(&models.User{}, &models.Order{}, &models.Withdraw{}); err != nil {
+	if err := conn.AutoMigrate(
+		&models.User{},
+		&models.Order{},
+		&models.Withdraw{},
+		&models.LoginAttempt{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.BalanceAdjustment{},
+		&models.AuditEvent{},
+		&models.AccrualLot{},
+		&models.PointsExpiration{},
+		&models.Transfer{},
+		&models.Campaign{},
+		&models.OrderBonus{},
+		&models.TierBonus{},
+		&models.Referral{},
+	); err != nil {
 		return nil, fmt.Errorf("error auto migrating models: %w", err)
 	}
 
+	if err := makeAppendOnly(
+		conn,
+		&models.BalanceAdjustment{},
+		&models.AuditEvent{},
+		&models.PointsExpiration{},
+		&models.Transfer{},
+		&models.OrderBonus{},
+		&models.TierBonus{},
+	); err != nil {
+		return nil, err
+	}
+
+	db := &DBStore{
+		conn: conn,
+		points: PointsPolicy{
+			LifetimeMonths:     defaultLifetimeMonths,
+			ExpiringSoonWindow: defaultExpiringSoon,
+		},
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	if err := db.backfillLots(ctx); err != nil {
+		return nil, err
+	}
+	if err := db.backfillReferralCodes(ctx); err != nil {
+		return nil, err
+	}
+
 	log.Println("successfully connected to the database")
 
-	return &DBStore{conn: conn}, nil
+	return db, nil
 }
 
 //go:embed migrations/*.sql
@@ -97,6 +212,27 @@ func runMigrations(dsn string) error {
 	return nil
 }
 
+// makeAppendOnly forbids UPDATE and DELETE on the tables of the given models.
+func makeAppendOnly(conn *gorm.DB, values ...interface{}) error {
+	for _, m := range values {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(m); err != nil {
+			return fmt.Errorf("error parsing model: %w", err)
+		}
+		table := stmt.Schema.Table
+
+		if err := conn.Exec(fmt.Sprintf(
+			`CREATE OR REPLACE TRIGGER %[1]s_append_only BEFORE UPDATE OR DELETE ON %[1]s
+			FOR EACH ROW EXECUTE FUNCTION forbid_modification()`,
+			table,
+		)).Error; err != nil {
+			return fmt.Errorf("error creating append-only trigger on %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
 func prepareConnPool(conn *gorm.DB) error {
 	sqlDB, err := conn.DB()
 	if err != nil {
@@ -133,8 +269,12 @@ func ConnectLoop(dsn string, tick time.Duration, timeout time.Duration) (*gorm.D
 	}
 }
 
-func (db *DBStore) CreateUser(user *models.User) (int64, error) {
-	result := db.conn.Create(user)
+func (db *DBStore) CreateUser(ctx context.Context, user *models.User) (int64, error) {
+	return createUser(db.conn.WithContext(ctx), user)
+}
+
+func createUser(tx *gorm.DB, user *models.User) (int64, error) {
+	result := tx.Create(user)
 
 	if result.Error != nil {
 		var pgErr *pgconn.PgError
@@ -150,28 +290,373 @@ func (db *DBStore) CreateUser(user *models.User) (int64, error) {
 	return result.RowsAffected, nil
 }
 
-func (db *DBStore) GetUser(u *models.User) (*models.User, error) {
+func (db *DBStore) GetUser(ctx context.Context, u *models.User) (*models.User, error) {
 	var user models.User
-	result := db.conn.Where(u).First(&user)
+	result := db.conn.WithContext(ctx).Where(u).First(&user)
 
 	if result.RowsAffected == 0 {
-		return nil, ErrLoginNotFound
+		return nil, models.ErrLoginNotFound
 	}
 
 	return &user, result.Error
 }
 
-func (db *DBStore) GetUserBalance(userID uint64) (*models.UserBalanceShema, error) {
+func (db *DBStore) UpdateUserPassword(ctx context.Context, userID uint64, hash string) (*models.User, error) {
+	var user models.User
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{ID: userID}).Updates(map[string]interface{}{
+			"password":      hash,
+			"token_version": gorm.Expr("token_version + 1"),
+		})
+		if err := result.Error; err != nil {
+			return fmt.Errorf("update user password error: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrLoginNotFound
+		}
+		if err := invalidatePasswordResetTokens(tx, userID); err != nil {
+			return err
+		}
+
+		return tx.Take(&user, userID).Error
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("password not updated: %w", err)
+	}
+
+	return &user, nil
+}
+
+// UpdateUserPasswordHash replaces the stored hash of the same password and keeps user sessions.
+func (db *DBStore) UpdateUserPasswordHash(ctx context.Context, userID uint64, hash string) error {
+	result := db.conn.WithContext(ctx).Model(&models.User{ID: userID}).Update("password", hash)
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error updating password hash: %w", err)
+	}
+
+	return nil
+}
+
+// CreatePasswordResetToken saves t and invalidates the tokens issued to the user before.
+func (db *DBStore) CreatePasswordResetToken(ctx context.Context, t *models.PasswordResetToken) error {
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := invalidatePasswordResetTokens(tx, t.UserID); err != nil {
+			return err
+		}
+		return tx.Create(t).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error saving password reset token: %w", err)
+	}
+	return nil
+}
+
+// invalidatePasswordResetTokens marks the outstanding tokens of the user used.
+func invalidatePasswordResetTokens(tx *gorm.DB, userID uint64) error {
+	result := tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now())
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error invalidating password reset tokens: %w", err)
+	}
+	return nil
+}
+
+func (db *DBStore) ResetUserPassword(ctx context.Context, tokenHash string, hash string) (*models.User, error) {
+	var user *models.User
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var token models.PasswordResetToken
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > now()", tokenHash).
+			Limit(1).
+			Find(&token)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error getting password reset token: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenNotValid
+		}
+
+		if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("error marking password reset token used: %w", err)
+		}
+
+		u, err := (&DBStore{conn: tx}).UpdateUserPassword(ctx, token.UserID, hash)
+		if err != nil {
+			return err
+		}
+		user = u
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("password not reset: %w", err)
+	}
+
+	return user, nil
+}
+
+func (db *DBStore) SetUserTOTPSecret(ctx context.Context, userID uint64, secret string) error {
+	result := db.conn.WithContext(ctx).Model(&models.User{ID: userID}).Updates(map[string]interface{}{
+		"totp_secret":  secret,
+		"totp_enabled": false,
+	})
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error saving totp secret: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStore) EnableUserTOTP(ctx context.Context, userID uint64, step int64, recoveryCodeHashes []string) error {
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{ID: userID}).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return fmt.Errorf("error enabling totp: %w", err)
+		}
+
+		if err := tx.Where(&models.RecoveryCode{UserID: userID}).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("error deleting old recovery codes: %w", err)
+		}
+
+		codes := make([]models.RecoveryCode, 0, len(recoveryCodeHashes))
+		for _, hash := range recoveryCodeHashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			return fmt.Errorf("error saving recovery codes: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("totp not enabled: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStore) DisableUserTOTP(ctx context.Context, userID uint64) error {
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{ID: userID}).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return fmt.Errorf("error disabling totp: %w", err)
+		}
+
+		if err := tx.Where(&models.RecoveryCode{UserID: userID}).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("error deleting recovery codes: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("totp not disabled: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep remembers the last accepted time step so a code cannot be replayed.
+func (db *DBStore) UseTOTPStep(ctx context.Context, userID uint64, step int64) error {
+	result := db.conn.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error saving totp step: %w", err)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+func (db *DBStore) UseRecoveryCode(ctx context.Context, userID uint64, codeHash string) error {
+	result := db.conn.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeNotValid
+	}
+
+	return nil
+}
+
+func (db *DBStore) SetUserRole(ctx context.Context, userID uint64, role models.Role) error {
+	result := db.conn.WithContext(ctx).Model(&models.User{ID: userID}).Update("role", role)
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error updating user role: %w", err)
+	}
+
+	if result.RowsAffected == 0 {
+		return models.ErrLoginNotFound
+	}
+
+	return nil
+}
+
+func (db *DBStore) CreateBalanceAdjustment(ctx context.Context, adj *models.BalanceAdjustment) error {
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		u, err := lockUser(tx, adj.UserID)
+		if err != nil {
+			return err
+		}
+
+		if adj.Amount < 0 {
+			if u.Balance+adj.Amount < 0 {
+				return ErrNotEnoughAmount
+			}
+			if err := tx.Model(u).Update("balance", gorm.Expr("balance + ?", adj.Amount)).Error; err != nil {
+				return fmt.Errorf("update user balance error: %w", err)
+			}
+			if err := debitPoints(tx, u.ID, -adj.Amount); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(adj).Error; err != nil {
+			return fmt.Errorf("create balance adjustment error: %w", err)
+		}
+
+		if adj.Amount > 0 {
+			return db.creditPoints(tx, u.ID, adj.Amount, models.LotSourceAdjustment, fmt.Sprint(adj.ID))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("balance adjustment not commited: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStore) GetBalanceAdjustments(ctx context.Context, userID uint64) ([]models.BalanceAdjustment, error) {
+	adjustments := make([]models.BalanceAdjustment, 0)
+	result := db.conn.WithContext(ctx).
+		Order("created_at asc").
+		Where(&models.BalanceAdjustment{UserID: userID}).
+		Find(&adjustments)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting balance adjustments: %w", err)
+	}
+
+	if len(adjustments) == 0 {
+		return nil, models.ErrUserHasNoItems
+	}
+
+	return adjustments, nil
+}
+
+const balanceHistoryQuery = `
+SELECT 'accrual' AS type, accrual AS amount, number AS "order", '' AS reason, '' AS counterparty,
+	uploaded_at AS created_at
+FROM orders WHERE user_id = @user AND status = @processed AND accrual > 0
+UNION ALL
+SELECT 'bonus', b.amount, b.order_number, c.name, '', b.created_at
+FROM order_bonuses b JOIN campaigns c ON c.id = b.campaign_id WHERE b.user_id = @user
+UNION ALL
+SELECT 'referral', r.bonus, '', '', u.login, r.rewarded_at
+FROM referrals r JOIN users u ON u.id = r.referee_id WHERE r.referrer_id = @user AND r.status = @rewarded
+UNION ALL
+SELECT 'withdrawal', -sum, order_num, '', '', processed_at
+FROM withdrawals WHERE user_id = @user AND status <> @rejected
+UNION ALL
+SELECT 'adjustment', amount, '', reason_code, '', created_at
+FROM balance_adjustments WHERE user_id = @user
+UNION ALL
+SELECT 'expiration', -amount, '', '', '', expired_at
+FROM points_expirations WHERE user_id = @user
+UNION ALL
+SELECT 'transfer_out', -t.sum, '', '', u.login, t.created_at
+FROM transfers t JOIN users u ON u.id = t.recipient_id WHERE t.sender_id = @user
+UNION ALL
+SELECT 'transfer_in', t.sum, '', '', u.login, t.created_at
+FROM transfers t JOIN users u ON u.id = t.sender_id WHERE t.recipient_id = @user
+ORDER BY created_at DESC`
+
+func (db *DBStore) GetBalanceHistory(ctx context.Context, userID uint64) ([]models.BalanceHistoryEntry, error) {
+	history := make([]models.BalanceHistoryEntry, 0)
+	result := db.conn.WithContext(ctx).Raw(balanceHistoryQuery,
+		sql.Named("user", userID), sql.Named("processed", models.PROCESSED),
+		sql.Named("rewarded", models.ReferralRewarded), sql.Named("rejected", models.WithdrawRejected),
+	).Scan(&history)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting balance history: %w", err)
+	}
+
+	if len(history) == 0 {
+		return nil, models.ErrUserHasNoItems
+	}
+
+	return history, nil
+}
+
+func (db *DBStore) GetUserBalance(ctx context.Context, userID uint64) (*models.UserBalanceShema, error) {
 	var user models.User
 	var userBalance models.UserBalanceShema
-	result := db.conn.Model(&user).Where(&models.User{ID: userID}).Take(&userBalance)
+	result := db.conn.WithContext(ctx).Model(&user).Where(&models.User{ID: userID}).Take(&userBalance)
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting user balance: %w", err)
+	}
+
+	expiring, err := db.getExpiringPoints(ctx, userID, time.Now().Add(db.points.ExpiringSoonWindow))
+	if err != nil {
+		return nil, err
+	}
+	userBalance.Expiring = expiring
+	for _, e := range expiring {
+		userBalance.ExpiringSoon += e.Amount
+	}
+
+	var pending struct {
+		Amount float64
+		Count  int64
+	}
+	result = db.conn.WithContext(ctx).Model(&models.Order{}).
+		Select("COALESCE(SUM(accrual), 0) AS amount, COUNT(*) AS count").
+		Where("user_id = ? AND status IN ?", userID, models.PendingStatuses).
+		Take(&pending)
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting user pending balance: %w", err)
+	}
+	userBalance.Pending = pending.Amount
+	userBalance.PendingCount = pending.Count
 
-	return &userBalance, result.Error
+	tier, err := db.getUserTier(db.conn.WithContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	userBalance.Tier = tier.Name
+
+	return &userBalance, nil
 }
 
-func (db *DBStore) PutOrder(number string, userID uint64) error {
+func (db *DBStore) PutOrder(ctx context.Context, number string, userID uint64) error {
 	var order models.Order
-	result := db.conn.
+	result := db.conn.WithContext(ctx).
 		Where(models.Order{Number: number}).
 		Attrs(models.Order{UserID: userID, Status: models.NEW}).
 		FirstOrCreate(&order)
@@ -191,17 +676,88 @@ func (db *DBStore) PutOrder(number string, userID uint64) error {
 	return nil
 }
 
-func (db *DBStore) UpdateOrder(o *models.Order) (int64, error) {
-	result := db.conn.Model(o).Updates(&models.Order{Accrual: o.Accrual, Status: o.Status})
-	return result.RowsAffected, result.Error
+// UpdateOrder moves a not yet finished order to o.Status and credits the accrual once the order is PROCESSED.
+// Updates of finished orders are ignored, so repeated results never credit twice.
+func (db *DBStore) UpdateOrder(ctx context.Context, o *models.Order) (int64, error) {
+	var rowsAffected int64
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var stored models.Order
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(&models.Order{Number: o.Number}).
+			Limit(1).
+			Find(&stored)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error getting order: %w", err)
+		}
+		if result.RowsAffected == 0 || stored.Status.IsFinal() {
+			return nil
+		}
+
+		accrual := o.Accrual
+		if o.Status == models.INVALID {
+			accrual = 0
+		}
+		// Select writes zero accruals too, so a preliminary accrual does not outlive the order's lookup.
+		result = tx.Model(&stored).Select("accrual", "status").
+			Updates(&models.Order{Accrual: accrual, Status: o.Status})
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error updating order: %w", err)
+		}
+		rowsAffected = result.RowsAffected
+
+		if o.Status != models.PROCESSED {
+			return nil
+		}
+
+		referral, err := pendingReferral(tx, stored.UserID)
+		if err != nil {
+			return err
+		}
+		userIDs := []uint64{stored.UserID}
+		if referral != nil {
+			userIDs = append(userIDs, referral.ReferrerID)
+		}
+		if _, err := lockUsers(tx, userIDs...); err != nil {
+			return err
+		}
+
+		stored.Accrual = o.Accrual
+		if o.Accrual > 0 {
+			// The tier is reached by earlier orders, so it is applied before the order itself is credited.
+			if err := db.applyTier(tx, &stored); err != nil {
+				return err
+			}
+			err := db.creditPoints(tx, stored.UserID, o.Accrual, models.LotSourceOrder, stored.Number)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := db.applyCampaigns(tx, &stored); err != nil {
+			return err
+		}
+
+		if referral != nil {
+			return db.rewardReferral(tx, referral)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("order not updated: %w", err)
+	}
+
+	return rowsAffected, nil
 }
 
-func (db *DBStore) GetUnprocessedOrders() ([]models.Order, error) {
+// GetUnprocessedOrders returns pending orders that are due for an accrual lookup and not flagged for review.
+func (db *DBStore) GetUnprocessedOrders(ctx context.Context) ([]models.Order, error) {
 	orders := make([]models.Order, 0)
-	result := db.conn.Where(
-		"status = @new OR status = @processing",
-		sql.Named("new", models.NEW), sql.Named("processing", models.PROCESSING),
-	).Find(&orders)
+	result := db.conn.WithContext(ctx).
+		Where("status IN ?", models.PendingStatuses).
+		Where("review_reason = ''").
+		Where("next_lookup_at IS NULL OR next_lookup_at <= now()").
+		Find(&orders)
 
 	if err := result.Error; err != nil {
 		return nil, fmt.Errorf("error getting all unprocessed orders: %w", err)
@@ -210,14 +766,43 @@ func (db *DBStore) GetUnprocessedOrders() ([]models.Order, error) {
 	return orders, nil
 }
 
-func (db *DBStore) GetUserOrders(userID uint64) ([]models.Order, error) {
+func (db *DBStore) GetOrder(ctx context.Context, number string) (*models.Order, error) {
+	var order models.Order
+	result := db.conn.WithContext(ctx).Where(&models.Order{Number: number}).Limit(1).Find(&order)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting order: %w", err)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrOrderNotFound
+	}
+
+	return &order, nil
+}
+
+const orderWithBonusColumns = `orders.*,
+	(SELECT COALESCE(SUM(amount), 0) FROM order_bonuses b WHERE b.order_number = orders.number) +
+	(SELECT COALESCE(SUM(amount), 0) FROM tier_bonuses t WHERE t.order_number = orders.number) AS bonus`
+
+func (db *DBStore) GetUserOrders(ctx context.Context, userID uint64) ([]models.Order, error) {
 	orders := make([]models.Order, 0)
-	result := db.conn.Order("uploaded_at asc").Where(&models.Order{UserID: userID}).Find(&orders)
+	result := db.conn.WithContext(ctx).
+		Select(orderWithBonusColumns).
+		Order("uploaded_at asc").
+		Where(&models.Order{UserID: userID}).
+		Find(&orders)
 
 	if err := result.Error; err != nil {
 		return nil, fmt.Errorf("error getting all user orders: %w", err)
 	}
 
+	// Users see the accrual once it is credited, preliminary ones only count as pending balance.
+	for i := range orders {
+		if orders[i].Status != models.PROCESSED {
+			orders[i].Accrual = 0
+		}
+	}
+
 	if len(orders) == 0 {
 		return nil, models.ErrUserHasNoItems
 	}
@@ -225,25 +810,44 @@ func (db *DBStore) GetUserOrders(userID uint64) ([]models.Order, error) {
 	return orders, nil
 }
 
-func (db *DBStore) CreateWithdraw(userID uint64, w models.BalanceWithdrawShema) error {
-	u, err := db.GetUser(&models.User{ID: userID})
-	if err != nil {
-		return fmt.Errorf("cant get user: %w", err)
-	}
+// CreateWithdraw debits the user. A pending withdrawal holds the points but is not counted as withdrawn
+// until it is approved.
+func (db *DBStore) CreateWithdraw(
+	ctx context.Context,
+	userID uint64,
+	w models.BalanceWithdrawShema,
+	status models.WithdrawStatus,
+) error {
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		u, err := lockUser(tx, userID)
+		if err != nil {
+			return fmt.Errorf("cant get user: %w", err)
+		}
 
-	if u.Balance < w.Sum {
-		return ErrNotEnoughAmount
-	}
+		if err := db.checkWithdrawLimits(tx, userID, w.Sum); err != nil {
+			return err
+		}
 
-	u.Balance -= w.Sum
-	u.Withdrawn += w.Sum
+		if u.Balance < w.Sum {
+			return ErrNotEnoughAmount
+		}
 
-	err = db.conn.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Save(u).Error; err != nil {
+		updates := map[string]interface{}{
+			"balance": gorm.Expr("balance - ?", w.Sum),
+		}
+		if status == models.WithdrawProcessed {
+			updates["withdrawn"] = gorm.Expr("withdrawn + ?", w.Sum)
+		}
+		if err := tx.Model(u).Updates(updates).Error; err != nil {
 			return fmt.Errorf("update user balance error: %w", err)
 		}
 
-		if err := tx.Create(&models.Withdraw{OrderNum: w.Order, Sum: w.Sum, UserID: userID}).Error; err != nil {
+		if err := debitPoints(tx, userID, w.Sum); err != nil {
+			return err
+		}
+
+		withdraw := models.Withdraw{OrderNum: w.Order, Sum: w.Sum, UserID: userID, Status: status}
+		if err := tx.Create(&withdraw).Error; err != nil {
 			return fmt.Errorf("create withdraw error: %w", err)
 		}
 
@@ -257,9 +861,9 @@ func (db *DBStore) CreateWithdraw(userID uint64, w models.BalanceWithdrawShema)
 	return nil
 }
 
-func (db *DBStore) GetWithdrawals(userID uint64) ([]models.Withdraw, error) {
+func (db *DBStore) GetWithdrawals(ctx context.Context, userID uint64) ([]models.Withdraw, error) {
 	withdrawals := make([]models.Withdraw, 0)
-	result := db.conn.Order("processed_at asc").Where(&models.Withdraw{UserID: userID}).Find(&withdrawals)
+	result := db.conn.WithContext(ctx).Order("processed_at asc").Where(&models.Withdraw{UserID: userID}).Find(&withdrawals)
 
 	if err := result.Error; err != nil {
 		return nil, fmt.Errorf("error getting all user withdrawals: %w", err)
@@ -272,13 +876,95 @@ func (db *DBStore) GetWithdrawals(userID uint64) ([]models.Withdraw, error) {
 	return withdrawals, nil
 }
 
-func (db *DBStore) Ping() error {
-	sqlDB, err := db.conn.DB()
+func (db *DBStore) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	attempts := make([]models.LoginAttempt, 0, 1)
+	result := db.conn.WithContext(ctx).Where(&models.LoginAttempt{Key: key}).Limit(1).Find(&attempts)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting login attempt: %w", err)
+	}
+
+	if len(attempts) == 0 {
+		return &models.LoginAttempt{Key: key}, nil
+	}
+
+	return &attempts[0], nil
+}
+
+// UpdateLoginAttempt locks the attempt row, creating it if needed, so that instances
+// sharing the database count failures without losing concurrent ones.
+func (db *DBStore) UpdateLoginAttempt(ctx context.Context, key string, update func(a *models.LoginAttempt)) error {
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginAttempt{Key: key})
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error creating login attempt: %w", err)
+		}
+
+		var a models.LoginAttempt
+		result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&models.LoginAttempt{Key: key}).First(&a)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error locking login attempt: %w", err)
+		}
+
+		update(&a)
+		if err := tx.Save(&a).Error; err != nil {
+			return fmt.Errorf("error saving login attempt: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error updating login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStore) DeleteLoginAttempt(ctx context.Context, key string) error {
+	result := db.conn.WithContext(ctx).Delete(&models.LoginAttempt{Key: key})
+
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error deleting login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DBStore) CreateAuditEvent(ctx context.Context, e *models.AuditEvent) error {
+	if err := db.conn.WithContext(ctx).Create(e).Error; err != nil {
+		return fmt.Errorf("error saving audit event: %w", err)
+	}
+	return nil
+}
+
+func (db *DBStore) GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	events := make([]models.AuditEvent, 0)
+	query := db.conn.WithContext(ctx).Where(&models.AuditEvent{
+		ActorID: filter.ActorID,
+		Action:  filter.Action,
+		Target:  filter.Target,
+	})
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	result := query.Order("created_at desc").Limit(filter.Limit).Offset(filter.Offset).Find(&events)
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+func (db *DBStore) Ping(ctx context.Context) error {
+	sqlDB, err := db.conn.WithContext(ctx).DB()
 	if err != nil {
 		return fmt.Errorf("error getting sql.DB interface: %w", err)
 	}
 
-	if err := sqlDB.Ping(); err != nil {
+	if err := sqlDB.PingContext(ctx); err != nil {
 		return fmt.Errorf("lost connection to DB: %w", err)
 	}
 
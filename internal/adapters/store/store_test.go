@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStore connects to the database from TEST_DATABASE_URI, tests needing it are skipped without one.
+func newTestStore(t *testing.T) *DBStore {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	s, err := NewStore(context.Background(), dsn, "error")
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+
+	return s.(*DBStore)
+}
+
+func newTestUser(t *testing.T, db *DBStore) *models.User {
+	t.Helper()
+
+	u := &models.User{Login: fmt.Sprintf("%v-%v", t.Name(), time.Now().UnixNano()), Password: "-"}
+	_, err := db.CreateUser(context.Background(), u)
+	require.NoError(t, err)
+
+	return u
+}
+
+func TestPendingAccrual(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	u := newTestUser(t, db)
+
+	number := fmt.Sprint(time.Now().UnixNano())
+	require.NoError(t, db.PutOrder(ctx, number, u.ID))
+	_, err := db.UpdateOrder(ctx, &models.Order{Number: number, Status: models.PROCESSING, Accrual: 50})
+	require.NoError(t, err)
+
+	balance, err := db.GetUserBalance(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, 50.0, balance.Pending)
+	require.Equal(t, int64(1), balance.PendingCount)
+	require.Equal(t, 0.0, balance.Balance, "preliminary accrual must not be credited")
+}
+
+func TestTierBonus(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	u := newTestUser(t, db)
+	WithTierPolicy(TierPolicy{
+		Tiers:  []models.Tier{{Name: "gold", Threshold: 100, Multiplier: 2}},
+		Window: time.Hour,
+	})(db)
+
+	process := func(accrual float64) *models.Order {
+		number := fmt.Sprint(time.Now().UnixNano())
+		require.NoError(t, db.PutOrder(ctx, number, u.ID))
+		_, err := db.UpdateOrder(ctx, &models.Order{Number: number, Status: models.PROCESSED, Accrual: accrual})
+		require.NoError(t, err)
+		o, err := db.GetOrder(ctx, number)
+		require.NoError(t, err)
+		return o
+	}
+
+	// The first order reaches the tier, the second one gets the bonus.
+	require.Equal(t, 100.0, process(100).Accrual)
+	o := process(50)
+	require.Equal(t, 50.0, o.Accrual, "the base accrual is stored in the order")
+
+	orders, err := db.GetUserOrders(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, 50.0, orders[len(orders)-1].Bonus)
+
+	balance, err := db.GetUserBalance(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, 200.0, balance.Balance)
+	require.Equal(t, "gold", balance.Tier)
+}
+
+func TestUpdateOrderDropsPreliminaryAccrual(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	u := newTestUser(t, db)
+
+	tests := []struct {
+		name   string
+		status models.Status
+	}{
+		{name: "Rejected by accrual", status: models.INVALID},
+		{name: "Processed without accrual", status: models.PROCESSED},
+	}
+
+	for _, tt := range tests {
+		number := fmt.Sprint(time.Now().UnixNano())
+		require.NoError(t, db.PutOrder(ctx, number, u.ID))
+		_, err := db.UpdateOrder(ctx, &models.Order{Number: number, Status: models.PROCESSING, Accrual: 50})
+		require.NoError(t, err)
+
+		orders, err := db.GetUserOrders(ctx, u.ID)
+		require.NoError(t, err)
+		require.Zero(t, orders[len(orders)-1].Accrual, "%v: preliminary accrual is not listed", tt.name)
+
+		_, err = db.UpdateOrder(ctx, &models.Order{Number: number, Status: tt.status})
+		require.NoError(t, err)
+
+		o, err := db.GetOrder(ctx, number)
+		require.NoError(t, err)
+		require.Equal(t, tt.status, o.Status, tt.name)
+		require.Zero(t, o.Accrual, tt.name)
+	}
+
+	balance, err := db.GetUserBalance(ctx, u.ID)
+	require.NoError(t, err)
+	require.Zero(t, balance.Balance)
+	require.Zero(t, balance.Pending)
+
+	_, err = db.GetBalanceHistory(ctx, u.ID)
+	require.ErrorIs(t, err, models.ErrUserHasNoItems, "no accrual is listed in the history")
+}
+
+func TestPingUsesContext(t *testing.T) {
+	db := newTestStore(t)
+
+	require.NoError(t, db.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, db.Ping(ctx), context.Canceled)
+}
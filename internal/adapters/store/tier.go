@@ -0,0 +1,75 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+)
+
+type TierPolicy struct {
+	// Tiers are ordered by threshold.
+	Tiers  []models.Tier
+	Window time.Duration
+}
+
+func WithTierPolicy(policy TierPolicy) Option {
+	return func(db *DBStore) {
+		db.tiers = policy
+	}
+}
+
+// getUserTier returns the highest tier reached by the base accruals of orders within the tier window.
+// Tier and campaign bonuses are credited as lots of their own sources and do not count.
+func (db *DBStore) getUserTier(tx *gorm.DB, userID uint64) (*models.Tier, error) {
+	tier := models.BaseTier
+	if len(db.tiers.Tiers) == 0 {
+		return &tier, nil
+	}
+
+	var accrued float64
+	result := tx.Model(&models.AccrualLot{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("user_id = ? AND source = ? AND accrued_at >= ?",
+			userID, models.LotSourceOrder, time.Now().Add(-db.tiers.Window)).
+		Scan(&accrued)
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting accrued points: %w", err)
+	}
+
+	for _, t := range db.tiers.Tiers {
+		if accrued < t.Threshold {
+			break
+		}
+		tier = t
+	}
+
+	return &tier, nil
+}
+
+// applyTier credits the tier bonus of the just processed order.
+// The caller must hold the user lock, so the tier is not changed by concurrent orders.
+func (db *DBStore) applyTier(tx *gorm.DB, order *models.Order) error {
+	tier, err := db.getUserTier(tx, order.UserID)
+	if err != nil {
+		return err
+	}
+
+	bonus := order.Accrual * (tier.Multiplier - 1)
+	if bonus <= 0 {
+		return nil
+	}
+
+	if err := tx.Create(&models.TierBonus{
+		OrderNumber: order.Number,
+		UserID:      order.UserID,
+		Tier:        tier.Name,
+		Multiplier:  tier.Multiplier,
+		Amount:      bonus,
+	}).Error; err != nil {
+		return fmt.Errorf("error creating tier bonus: %w", err)
+	}
+
+	return db.creditPoints(tx, order.UserID, bonus, models.LotSourceTier, order.Number)
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+)
+
+// TransferPolicy limits what a user may send within the last 24 hours. Zero means no limit.
+type TransferPolicy struct {
+	DailySum   float64
+	DailyCount int64
+}
+
+func WithTransferPolicy(policy TransferPolicy) Option {
+	return func(db *DBStore) {
+		db.transfers = policy
+	}
+}
+
+// CreateTransfer moves points from the sender to the user with the given login.
+// Points keep the expiration dates of the sender's lots they came from.
+// A repeated request with the same idempotency key returns the stored transfer.
+func (db *DBStore) CreateTransfer(
+	ctx context.Context,
+	senderID uint64,
+	t models.TransferSchema,
+	idempotencyKey string,
+) (*models.Transfer, error) {
+	var transfer models.Transfer
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var recipient models.User
+		result := tx.Where(&models.User{Login: t.Login}).Limit(1).Find(&recipient)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error getting recipient: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrLoginNotFound
+		}
+		if recipient.ID == senderID {
+			return ErrSelfTransfer
+		}
+
+		locked, err := lockUsers(tx, senderID, recipient.ID)
+		if err != nil {
+			return err
+		}
+		sender := locked[senderID]
+
+		if idempotencyKey != "" {
+			result := tx.Where("sender_id = ? AND idempotency_key = ?", senderID, idempotencyKey).
+				Limit(1).
+				Find(&transfer)
+			if err := result.Error; err != nil {
+				return fmt.Errorf("error getting transfer: %w", err)
+			}
+			if result.RowsAffected > 0 {
+				if transfer.RecipientID != recipient.ID || transfer.Sum != t.Sum {
+					return ErrIdempotencyKeyReused
+				}
+				return nil
+			}
+		}
+
+		if sender.Balance < t.Sum {
+			return ErrNotEnoughAmount
+		}
+		if err := db.checkTransferLimits(tx, senderID, t.Sum); err != nil {
+			return err
+		}
+		// Points given away can be withdrawn by the recipient, so they count against the withdrawal limits.
+		if err := db.checkWithdrawLimits(tx, senderID, t.Sum); err != nil {
+			return err
+		}
+
+		transfer = models.Transfer{
+			SenderID:    senderID,
+			RecipientID: recipient.ID,
+			Sum:         t.Sum,
+		}
+		if idempotencyKey != "" {
+			transfer.IdempotencyKey = &idempotencyKey
+		}
+		if err := tx.Create(&transfer).Error; err != nil {
+			return fmt.Errorf("create transfer error: %w", err)
+		}
+
+		if err := tx.Model(sender).Update("balance", gorm.Expr("balance - ?", t.Sum)).Error; err != nil {
+			return fmt.Errorf("update sender balance error: %w", err)
+		}
+		if err := tx.Model(&recipient).Update("balance", gorm.Expr("balance + ?", t.Sum)).Error; err != nil {
+			return fmt.Errorf("update recipient balance error: %w", err)
+		}
+
+		parts, err := debitLots(tx, senderID, t.Sum)
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			err := createLot(tx, recipient.ID, part.Remaining, models.LotSourceTransfer,
+				fmt.Sprint(transfer.ID), part.ExpiresAt)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("transfer not commited: %w", err)
+	}
+
+	transfer.Recipient = t.Login
+	return &transfer, nil
+}
+
+func (db *DBStore) checkTransferLimits(tx *gorm.DB, senderID uint64, sum float64) error {
+	if db.transfers.DailySum <= 0 && db.transfers.DailyCount <= 0 {
+		return nil
+	}
+
+	var sent struct {
+		Sum   float64
+		Count int64
+	}
+	result := tx.Model(&models.Transfer{}).
+		Select("COALESCE(SUM(sum), 0) AS sum, COUNT(*) AS count").
+		Where("sender_id = ? AND created_at >= ?", senderID, time.Now().Add(-24*time.Hour)).
+		Take(&sent)
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error getting sent transfers: %w", err)
+	}
+
+	if db.transfers.DailySum > 0 && sent.Sum+sum > db.transfers.DailySum {
+		return ErrTransferLimitExceeded
+	}
+	if db.transfers.DailyCount > 0 && sent.Count >= db.transfers.DailyCount {
+		return ErrTransferLimitExceeded
+	}
+
+	return nil
+}
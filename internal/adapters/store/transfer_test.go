@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferCountsAgainstWithdrawLimits(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	WithWithdrawPolicy(WithdrawPolicy{DailySum: 100})(db)
+	sender := newTestUser(t, db)
+	recipient := newTestUser(t, db)
+
+	err := db.CreateBalanceAdjustment(ctx, &models.BalanceAdjustment{
+		UserID:     sender.ID,
+		Amount:     500,
+		ReasonCode: models.ReasonCorrection,
+	})
+	require.NoError(t, err)
+
+	_, err = db.CreateTransfer(ctx, sender.ID, models.TransferSchema{Login: recipient.Login, Sum: 80}, "")
+	require.NoError(t, err)
+
+	_, err = db.CreateTransfer(ctx, sender.ID, models.TransferSchema{Login: recipient.Login, Sum: 30}, "")
+	require.ErrorIs(t, err, ErrWithdrawDailyLimit)
+
+	err = db.CreateWithdraw(ctx, sender.ID, models.BalanceWithdrawShema{Order: "2377225624", Sum: 30},
+		models.WithdrawProcessed)
+	require.ErrorIs(t, err, ErrWithdrawDailyLimit, "transfers count against withdrawals too")
+}
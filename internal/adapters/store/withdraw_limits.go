@@ -0,0 +1,80 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrWithdrawBelowMin = errors.New("withdrawal is below the minimum")
+var ErrWithdrawAboveMax = errors.New("withdrawal is above the maximum")
+var ErrWithdrawDailyLimit = errors.New("daily withdrawal limit exceeded")
+var ErrWithdrawMonthlyLimit = errors.New("monthly withdrawal limit exceeded")
+var ErrWithdrawRateLimit = errors.New("too many withdrawals per hour")
+
+// WithdrawPolicy restricts points leaving the account: withdrawals and transfers to other users.
+// Zero values mean no limit. Daily and monthly caps are counted from the start of the calendar day and month.
+type WithdrawPolicy struct {
+	MinSum      float64
+	MaxSum      float64
+	DailySum    float64
+	MonthlySum  float64
+	HourlyCount int64
+}
+
+func WithWithdrawPolicy(policy WithdrawPolicy) Option {
+	return func(db *DBStore) {
+		db.withdrawals = policy
+	}
+}
+
+// checkWithdrawLimits must be called with the user locked, so concurrent withdrawals and transfers are counted.
+func (db *DBStore) checkWithdrawLimits(tx *gorm.DB, userID uint64, sum float64) error {
+	p := db.withdrawals
+	if p.MinSum > 0 && sum < p.MinSum {
+		return ErrWithdrawBelowMin
+	}
+	if p.MaxSum > 0 && sum > p.MaxSum {
+		return ErrWithdrawAboveMax
+	}
+	if p.DailySum <= 0 && p.MonthlySum <= 0 && p.HourlyCount <= 0 {
+		return nil
+	}
+
+	var withdrawn struct {
+		Day   float64
+		Month float64
+		Hour  int64
+	}
+	result := tx.Raw(`
+SELECT
+	COALESCE(SUM(sum) FILTER (WHERE at >= date_trunc('day', now())), 0) AS day,
+	COALESCE(SUM(sum) FILTER (WHERE at >= date_trunc('month', now())), 0) AS month,
+	COUNT(*) FILTER (WHERE at >= now() - interval '1 hour') AS hour
+FROM (
+	SELECT sum, processed_at AS at FROM withdrawals WHERE user_id = @user AND status <> @rejected
+	UNION ALL
+	SELECT sum, created_at FROM transfers WHERE sender_id = @user
+) outgoing
+WHERE at >= LEAST(date_trunc('month', now()), now() - interval '1 hour')`,
+		sql.Named("user", userID), sql.Named("rejected", models.WithdrawRejected),
+	).Scan(&withdrawn)
+	if err := result.Error; err != nil {
+		return fmt.Errorf("error getting recent withdrawals: %w", err)
+	}
+
+	if p.HourlyCount > 0 && withdrawn.Hour >= p.HourlyCount {
+		return ErrWithdrawRateLimit
+	}
+	if p.DailySum > 0 && withdrawn.Day+sum > p.DailySum {
+		return ErrWithdrawDailyLimit
+	}
+	if p.MonthlySum > 0 && withdrawn.Month+sum > p.MonthlySum {
+		return ErrWithdrawMonthlyLimit
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (db *DBStore) GetPendingWithdrawals(ctx context.Context) ([]models.PendingWithdrawSchema, error) {
+	withdrawals := make([]models.PendingWithdrawSchema, 0)
+	result := db.conn.WithContext(ctx).Model(&models.Withdraw{}).
+		Where(&models.Withdraw{Status: models.WithdrawPending}).
+		Order("processed_at asc").
+		Find(&withdrawals)
+
+	if err := result.Error; err != nil {
+		return nil, fmt.Errorf("error getting pending withdrawals: %w", err)
+	}
+
+	if len(withdrawals) == 0 {
+		return nil, models.ErrUserHasNoItems
+	}
+
+	return withdrawals, nil
+}
+
+// ResolveWithdrawal approves a pending withdrawal or rejects it, returning the held points to the user.
+func (db *DBStore) ResolveWithdrawal(ctx context.Context, id uint64, approve bool) (*models.Withdraw, error) {
+	var withdraw models.Withdraw
+	err := db.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Limit(1).Find(&withdraw, id)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error getting withdrawal: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return ErrWithdrawNotFound
+		}
+
+		u, err := lockUser(tx, withdraw.UserID)
+		if err != nil {
+			return err
+		}
+
+		result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&withdraw, id)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("error locking withdrawal: %w", err)
+		}
+		if withdraw.Status != models.WithdrawPending {
+			return ErrWithdrawNotPending
+		}
+
+		withdraw.Status = models.WithdrawRejected
+		if approve {
+			withdraw.Status = models.WithdrawProcessed
+		}
+		if err := tx.Model(&withdraw).Update("status", withdraw.Status).Error; err != nil {
+			return fmt.Errorf("error updating withdrawal: %w", err)
+		}
+
+		if approve {
+			err := tx.Model(u).Update("withdrawn", gorm.Expr("withdrawn + ?", withdraw.Sum)).Error
+			if err != nil {
+				return fmt.Errorf("update user withdrawn error: %w", err)
+			}
+			return nil
+		}
+
+		return db.creditPoints(tx, u.ID, withdraw.Sum, models.LotSourceRefund, fmt.Sprint(withdraw.ID))
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("withdrawal not resolved: %w", err)
+	}
+
+	return &withdraw, nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/adapters/accrual"
+	"github.com/rawen554/go-loyal/internal/adapters/store"
+	"github.com/rawen554/go-loyal/internal/processing"
+)
+
+// AccrualIngester applies accrual results pushed by the accrual system.
+type AccrualIngester interface {
+	ApplyOrderInfo(ctx context.Context, info *accrual.AccrualOrderInfoShema) error
+}
+
+func WithAccrualIngester(i AccrualIngester) Option {
+	return func(a *App) {
+		a.ingester = i
+	}
+}
+
+func (a *App) PushAccrual(c *gin.Context) {
+	var info accrual.AccrualOrderInfoShema
+	if err := json.NewDecoder(c.Request.Body).Decode(&info); err != nil || info.Order == "" {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := a.ingester.ApplyOrderInfo(c.Request.Context(), &info); err != nil {
+		switch {
+		case errors.Is(err, processing.ErrInvalidOrderInfo):
+			c.Writer.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, store.ErrOrderNotFound):
+			c.Writer.WriteHeader(http.StatusNotFound)
+		default:
+			a.logger.Errorf("error applying pushed accrual of order %v: %v", info.Order, err)
+			c.Writer.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.Writer.WriteHeader(http.StatusOK)
+}
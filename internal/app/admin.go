@@ -0,0 +1,389 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/adapters/store"
+	"github.com/rawen554/go-loyal/internal/audit"
+	"github.com/rawen554/go-loyal/internal/middleware/auth"
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+const (
+	userIDParam       = "id"
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func (a *App) AdminFindUser(c *gin.Context) {
+	login := c.Query("login")
+	if login == "" {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	a.writeAdminUser(c, &models.User{Login: login})
+}
+
+func (a *App) AdminGetUser(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	a.writeAdminUser(c, &models.User{ID: userID})
+}
+
+func (a *App) writeAdminUser(c *gin.Context, filter *models.User) {
+	u, err := a.store.GetUser(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, models.ErrLoginNotFound) {
+			c.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		a.logger.Errorf("cannot get user: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AdminUserSchema{
+		ID:          u.ID,
+		Login:       u.Login,
+		Role:        u.Role,
+		Balance:     u.Balance,
+		Withdrawn:   u.Withdrawn,
+		TOTPEnabled: u.TOTPEnabled,
+	})
+}
+
+//nolint:dupl // code deduplication will lead to bad code extending in future
+func (a *App) AdminGetUserOrders(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	orders, err := a.store.GetUserOrders(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrUserHasNoItems) {
+			c.Writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		a.logger.Errorf("error getting user orders: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+//nolint:dupl // code deduplication will lead to bad code extending in future
+func (a *App) AdminGetUserWithdrawals(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	withdrawals, err := a.store.GetWithdrawals(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrUserHasNoItems) {
+			c.Writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		a.logger.Errorf("error getting user withdrawals: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawals)
+}
+
+func (a *App) AdminAdjustBalance(c *gin.Context) {
+	operatorID := c.GetUint64(auth.UserIDKey.ToString())
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+	// Manual credits are controlled by having someone else grant them.
+	if userID == operatorID {
+		c.JSON(http.StatusForbidden, models.ErrorSchema{Error: "self_adjustment"})
+		return
+	}
+
+	var adjustmentReq models.BalanceAdjustmentSchema
+	if err := json.NewDecoder(c.Request.Body).Decode(&adjustmentReq); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if adjustmentReq.Amount == 0 || !adjustmentReq.ReasonCode.IsValid() {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if adjustmentReq.ReasonCode == models.ReasonOther && adjustmentReq.Note == "" {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	adjustment := models.BalanceAdjustment{
+		UserID:     userID,
+		OperatorID: operatorID,
+		Amount:     adjustmentReq.Amount,
+		ReasonCode: adjustmentReq.ReasonCode,
+		Note:       adjustmentReq.Note,
+	}
+	if err := a.store.CreateBalanceAdjustment(c.Request.Context(), &adjustment); err != nil {
+		switch {
+		case errors.Is(err, models.ErrLoginNotFound):
+			c.Writer.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, store.ErrNotEnoughAmount):
+			c.Writer.WriteHeader(http.StatusPaymentRequired)
+		default:
+			a.logger.Errorf("cannot adjust balance: %v", err)
+			c.Writer.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: operatorID,
+		Action:  audit.ActionAdminAdjustment,
+		Target:  audit.UserTarget(userID),
+		After:   adjustment,
+	})
+	c.JSON(http.StatusOK, adjustment)
+}
+
+//nolint:dupl // code deduplication will lead to bad code extending in future
+func (a *App) AdminGetUserAdjustments(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	adjustments, err := a.store.GetBalanceAdjustments(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrUserHasNoItems) {
+			c.Writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		a.logger.Errorf("error getting balance adjustments: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, adjustments)
+}
+
+func (a *App) AdminSetUserRole(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	var roleReq models.UserRoleSchema
+	if err := json.NewDecoder(c.Request.Body).Decode(&roleReq); err != nil || !roleReq.Role.IsValid() {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		if errors.Is(err, models.ErrLoginNotFound) {
+			c.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		a.logger.Errorf("cannot get user: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.store.SetUserRole(c.Request.Context(), userID, roleReq.Role); err != nil {
+		if errors.Is(err, models.ErrLoginNotFound) {
+			c.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		a.logger.Errorf("cannot set user role: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: c.GetUint64(auth.UserIDKey.ToString()),
+		Action:  audit.ActionAdminRoleChange,
+		Target:  audit.UserTarget(userID),
+		Before:  models.UserRoleSchema{Role: u.Role},
+		After:   roleReq,
+	})
+	c.Writer.WriteHeader(http.StatusOK)
+}
+
+// AdminGetAuditEvents filters by actor_id, action, target and an RFC 3339 from/to range.
+func (a *App) AdminGetAuditEvents(c *gin.Context) {
+	filter := models.AuditFilter{
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Limit:  defaultAuditLimit,
+	}
+
+	var err error
+	if v := c.Query("actor_id"); v != "" {
+		if filter.ActorID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			c.Writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			c.Writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			c.Writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+			c.Writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+			c.Writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := a.store.GetAuditEvents(c.Request.Context(), filter)
+	if err != nil {
+		a.logger.Errorf("error getting audit events: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: c.GetUint64(auth.UserIDKey.ToString()),
+		Action:  audit.ActionAdminAuditSearch,
+		After:   c.Request.URL.RawQuery,
+	})
+	c.JSON(http.StatusOK, events)
+}
+
+func parseUserIDParam(c *gin.Context) (uint64, bool) {
+	userID, err := strconv.ParseUint(c.Param(userIDParam), 10, 64)
+	if err != nil || userID == 0 {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
+
+func (a *App) AdminGetPendingWithdrawals(c *gin.Context) {
+	withdrawals, err := a.store.GetPendingWithdrawals(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, models.ErrUserHasNoItems) {
+			c.Writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		a.logger.Errorf("error getting pending withdrawals: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawals)
+}
+
+func (a *App) AdminApproveWithdrawal(c *gin.Context) {
+	a.resolveWithdrawal(c, true)
+}
+
+func (a *App) AdminRejectWithdrawal(c *gin.Context) {
+	a.resolveWithdrawal(c, false)
+}
+
+func (a *App) resolveWithdrawal(c *gin.Context, approve bool) {
+	withdrawID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || withdrawID == 0 {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	withdraw, err := a.store.ResolveWithdrawal(c.Request.Context(), withdrawID, approve)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrWithdrawNotFound):
+			c.Writer.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, store.ErrWithdrawNotPending):
+			c.Writer.WriteHeader(http.StatusConflict)
+		default:
+			a.logger.Errorf("cannot resolve withdrawal: %v", err)
+			c.Writer.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	action := audit.ActionWithdrawReject
+	if approve {
+		action = audit.ActionWithdrawApprove
+	}
+	a.audit.Record(c, audit.Event{
+		ActorID: c.GetUint64(auth.UserIDKey.ToString()),
+		Action:  action,
+		Target:  audit.UserTarget(withdraw.UserID),
+		Before:  models.WithdrawPending,
+		After:   withdraw,
+	})
+	c.JSON(http.StatusOK, withdraw)
+}
+
+func (a *App) AdminGetOrdersForReview(c *gin.Context) {
+	orders, err := a.store.GetOrdersForReview(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, models.ErrUserHasNoItems) {
+			c.Writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		a.logger.Errorf("error getting orders for review: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+func (a *App) AdminRequeueOrder(c *gin.Context) {
+	number := c.Param("number")
+
+	order, err := a.store.RequeueOrder(c.Request.Context(), number)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrOrderNotFound):
+			c.Writer.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, store.ErrOrderNotInReview):
+			c.Writer.WriteHeader(http.StatusConflict)
+		default:
+			a.logger.Errorf("cannot requeue order: %v", err)
+			c.Writer.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: c.GetUint64(auth.UserIDKey.ToString()),
+		Action:  audit.ActionOrderRequeue,
+		Target:  audit.OrderTarget(order.Number),
+	})
+	c.JSON(http.StatusOK, order)
+}
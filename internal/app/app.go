@@ -1,40 +1,153 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/rawen554/go-loyal/internal/adapters/accrual"
+	"github.com/rawen554/go-loyal/internal/adapters/notifier"
 	"github.com/rawen554/go-loyal/internal/adapters/store"
+	"github.com/rawen554/go-loyal/internal/audit"
+	"github.com/rawen554/go-loyal/internal/bruteforce"
 	"github.com/rawen554/go-loyal/internal/config"
 	"github.com/rawen554/go-loyal/internal/middleware/auth"
 	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/rawen554/go-loyal/internal/password"
+	"github.com/rawen554/go-loyal/internal/risk"
 	"github.com/rawen554/go-loyal/internal/utils"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type App struct {
-	config *config.ServerConfig
-	store  store.Store
-	logger *zap.SugaredLogger
+	config     *config.ServerConfig
+	store      store.Store
+	logger     *zap.SugaredLogger
+	loginGuard *bruteforce.Guard
+	resetGuard *bruteforce.Guard
+	notifier   notifier.Notifier
+	hasher     password.Hasher
+	audit      *audit.Recorder
+	risk       risk.Evaluator
+	breaker    *accrual.Breaker
+	backends   BackendBreakers
+	ingester   AccrualIngester
+}
+
+type Option func(*App)
+
+func WithNotifier(n notifier.Notifier) Option {
+	return func(a *App) {
+		a.notifier = n
+	}
+}
+
+func WithRiskEvaluator(e risk.Evaluator) Option {
+	return func(a *App) {
+		a.risk = e
+	}
+}
+
+// WithAccrualBreaker reports the state of the accrual circuit breaker in /health.
+func WithAccrualBreaker(b *accrual.Breaker) Option {
+	return func(a *App) {
+		a.breaker = b
+	}
+}
+
+// BackendBreakers reports the circuit breaker states of routed accrual backends.
+type BackendBreakers interface {
+	BreakerStates() map[string]accrual.BreakerState
+}
+
+// WithAccrualBackendBreakers reports the states of the accrual backend circuit breakers in /health.
+func WithAccrualBackendBreakers(b BackendBreakers) Option {
+	return func(a *App) {
+		a.backends = b
+	}
 }
 
 const (
-	bcryptCost   = 7
 	maxCookieAge = 3600 * 24 * 30
+	saltLen      = 16
+	keyLen       = 32
 )
 
-func NewApp(config *config.ServerConfig, store store.Store, logger *zap.SugaredLogger) *App {
-	return &App{
+func NewApp(
+	config *config.ServerConfig,
+	store store.Store,
+	logger *zap.SugaredLogger,
+	opts ...Option,
+) (*App, error) {
+	hasher, err := password.NewPolicy(config.PasswordHashAlgo, password.Argon2idParams{
+		Memory:  config.Argon2Memory,
+		Time:    config.Argon2Time,
+		Threads: config.Argon2Threads,
+		SaltLen: saltLen,
+		KeyLen:  keyLen,
+	}, config.BcryptCost)
+	if err != nil {
+		return nil, fmt.Errorf("error creating password hasher: %w", err)
+	}
+
+	riskEvaluator, err := risk.NewEvaluator(config.RiskEvaluator, risk.Rules{
+		NewAccountAge: config.RiskNewAccountAge,
+		NewIPWindow:   config.RiskNewIPWindow,
+		ReviewSum:     config.RiskReviewSum,
+		DenySum:       config.RiskDenySum,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating risk evaluator: %w", err)
+	}
+
+	attempts, err := bruteforce.NewStore(config.LoginAttemptsStore, store, config.LoginFailureWindow)
+	if err != nil {
+		return nil, fmt.Errorf("error creating login attempts store: %w", err)
+	}
+	resetRequests, err := bruteforce.NewStore(config.LoginAttemptsStore, store, config.PasswordResetWindow)
+	if err != nil {
+		return nil, fmt.Errorf("error creating password reset requests store: %w", err)
+	}
+
+	a := &App{
 		config: config,
 		store:  store,
 		logger: logger,
+		loginGuard: bruteforce.NewGuard(attempts, bruteforce.Config{
+			MaxLoginFailures: config.LoginMaxFailures,
+			MaxIPFailures:    config.LoginIPMaxFailures,
+			Window:           config.LoginFailureWindow,
+			Lockout:          config.LoginLockout,
+			BaseDelay:        config.LoginBaseDelay,
+			MaxDelay:         config.LoginMaxDelay,
+		}, logger.With("component", "login-guard")),
+		// Every reset request counts as an attempt, reaching the limit blocks requests for the window.
+		resetGuard: bruteforce.NewGuard(resetRequests, bruteforce.Config{
+			Scope:            "reset:",
+			MaxLoginFailures: config.PasswordResetMax,
+			MaxIPFailures:    config.PasswordResetIPMax,
+			Window:           config.PasswordResetWindow,
+			Lockout:          config.PasswordResetWindow,
+		}, logger.With("component", "reset-guard")),
+		notifier: notifier.NewLogNotifier(logger.With("component", "notifier")),
+		hasher:   hasher,
+		audit:    audit.NewRecorder(store, logger.With("component", "audit")),
+		risk:     riskEvaluator,
+	}
+
+	for _, opt := range opts {
+		opt(a)
 	}
+
+	return a, nil
 }
 
 func (a *App) NewServer() (*http.Server, error) {
@@ -65,10 +178,17 @@ func (a *App) Login(c *gin.Context) {
 		Password: userCreds.Password,
 	}
 
-	u, err := a.store.GetUser(&models.User{Login: userReq.Login})
+	ip := c.ClientIP()
+	if err := a.loginGuard.Check(c.Request.Context(), userReq.Login, ip); err != nil {
+		a.abortTooManyAttempts(c, err)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{Login: userReq.Login})
 	if err != nil {
-		if errors.Is(err, store.ErrLoginNotFound) {
+		if errors.Is(err, models.ErrLoginNotFound) {
 			a.logger.Errorf("login not found: %v", err)
+			a.failLogin(c, userReq.Login, 0)
 			res.WriteHeader(http.StatusUnauthorized)
 			return
 		} else {
@@ -78,47 +198,187 @@ func (a *App) Login(c *gin.Context) {
 		}
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(userReq.Password)); err != nil {
+	ok, needsRehash, err := a.hasher.Verify(userReq.Password, u.Password)
+	if err != nil {
+		a.logger.Errorf("cannot verify password: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.failLogin(c, userReq.Login, u.ID)
 		res.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	userReq.ID = u.ID
 
-	jwt, err := auth.BuildJWTString(userReq.ID, a.config.Key)
-	if err != nil {
+	if needsRehash {
+		a.rehashPassword(c.Request.Context(), u.ID, userReq.Password)
+	}
+
+	if u.TOTPEnabled {
+		if err := a.setPendingCookie(c, u); err != nil {
+			a.logger.Errorf("cannot build pending jwt string: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusAccepted, models.LoginStatusSchema{Status: loginStatus2FA})
+		return
+	}
+
+	a.completeLogin(c, u)
+}
+
+func (a *App) completeLogin(c *gin.Context, u *models.User) {
+	if err := a.loginGuard.Succeed(c.Request.Context(), u.Login); err != nil {
+		a.logger.Errorf("cannot reset login attempts: %v", err)
+	}
+
+	if err := a.setAuthCookie(c, u); err != nil {
 		a.logger.Errorf("cannot build jwt string for authorized user: %v", err)
-		res.WriteHeader(http.StatusInternalServerError)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: u.ID,
+		Action:  audit.ActionLogin,
+		Target:  audit.UserTarget(u.ID),
+	})
+	c.Writer.WriteHeader(http.StatusOK)
+}
+
+func (a *App) Health(c *gin.Context) {
+	health := models.HealthSchema{Status: models.HealthOK, Database: models.HealthOK}
+
+	if a.breaker != nil {
+		state := a.breaker.State()
+		health.Accrual = string(state)
+		if state != accrual.BreakerClosed {
+			health.Status = models.HealthDegraded
+		}
+	}
+
+	if a.backends != nil {
+		health.AccrualBackends = make(map[string]string)
+		for name, state := range a.backends.BreakerStates() {
+			health.AccrualBackends[name] = string(state)
+			if state != accrual.BreakerClosed {
+				health.Status = models.HealthDegraded
+			}
+		}
+	}
+
+	if err := a.store.Ping(c.Request.Context()); err != nil {
+		a.logger.Errorf("Error opening connection to DB: %v", err)
+		health.Status = models.HealthDown
+		health.Database = models.HealthDown
+		c.JSON(http.StatusServiceUnavailable, health)
+		return
+	}
+
+	c.JSON(http.StatusOK, health)
+}
+
+func (a *App) setAuthCookie(c *gin.Context, u *models.User) error {
+	jwt, err := auth.BuildJWTString(u, a.config.Key)
+	if err != nil {
+		return fmt.Errorf("error building jwt: %w", err)
+	}
 	c.SetCookie(auth.CookieName, jwt, maxCookieAge, "", "", false, true)
-	res.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (a *App) failLogin(c *gin.Context, login string, userID uint64) {
+	a.failAttempt(c, audit.ActionLoginFailed, login, userID)
+}
+
+// failAttempt records a failed credential check as action and counts it against the login guard.
+func (a *App) failAttempt(c *gin.Context, action string, login string, userID uint64) {
+	a.audit.Record(c, audit.Event{
+		ActorID: userID,
+		Action:  action,
+		Target:  audit.LoginTarget(login),
+	})
+
+	locked, err := a.loginGuard.Fail(c.Request.Context(), login, c.ClientIP())
+	if err != nil {
+		a.logger.Errorf("cannot record failed login attempt: %v", err)
+		return
+	}
+
+	if locked {
+		a.audit.Record(c, audit.Event{
+			ActorID: userID,
+			Action:  audit.ActionLoginLockout,
+			Target:  audit.LoginTarget(login),
+		})
+	}
+}
+
+func (a *App) abortTooManyAttempts(c *gin.Context, err error) {
+	var tooManyAttemptsError *bruteforce.TooManyAttemptsError
+	if !errors.As(err, &tooManyAttemptsError) {
+		a.logger.Errorf("cannot check login attempts: %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	retryAfter := int(math.Ceil(tooManyAttemptsError.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatus(http.StatusTooManyRequests)
 }
 
 func (a *App) Register(c *gin.Context) {
 	req := c.Request
 	res := c.Writer
 
-	userCreds := models.User{}
+	userCreds := models.UserCredentialsSchema{}
 	if err := json.NewDecoder(req.Body).Decode(&userCreds); err != nil {
 		a.logger.Errorf("body cannot be decoded: %v", err)
 		res.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	var referrer *models.User
+	if userCreds.ReferralCode != "" {
+		code := strings.ToUpper(userCreds.ReferralCode)
+		u, err := a.store.GetUser(c.Request.Context(), &models.User{ReferralCode: &code})
+		if err != nil {
+			a.logger.Infof("referral code not found: %v", err)
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		referrer = u
+	}
+
+	referralCode, err := utils.GenerateReferralCode()
+	if err != nil {
+		a.logger.Errorf("cannot generate referral code: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	userReq := models.User{
-		Login:    userCreds.Login,
-		Password: userCreds.Password,
+		Login:          userCreds.Login,
+		Password:       userCreds.Password,
+		Role:           models.RoleUser,
+		ReferralCode:   &referralCode,
+		RegistrationIP: c.ClientIP(),
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(userReq.Password), bcryptCost) //TODO: check sha512, cryptoready
+	hash, err := a.hasher.Hash(userReq.Password)
 	if err != nil {
 		a.logger.Errorf("cannot hash pass: %v", err)
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	userReq.Password = string(hash)
+	userReq.Password = hash
 
-	if _, err = a.store.CreateUser(&userReq); err != nil {
+	if referrer != nil {
+		_, err = a.store.CreateReferredUser(c.Request.Context(), &userReq, referrer.ID)
+	} else {
+		_, err = a.store.CreateUser(c.Request.Context(), &userReq)
+	}
+	if err != nil {
 		if errors.Is(err, store.ErrDuplicateLogin) {
 			a.logger.Errorf("login already taken: %v", err)
 			res.WriteHeader(http.StatusConflict)
@@ -130,16 +390,33 @@ func (a *App) Register(c *gin.Context) {
 		}
 	}
 
-	jwt, err := auth.BuildJWTString(userReq.ID, a.config.Key)
-	if err != nil {
+	if err := a.setAuthCookie(c, &userReq); err != nil {
 		a.logger.Errorf("cannot build jwt string: %v", err)
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	c.SetCookie(auth.CookieName, jwt, maxCookieAge, "", "", false, true)
+
+	a.audit.Record(c, audit.Event{
+		ActorID: userReq.ID,
+		Action:  audit.ActionRegister,
+		Target:  audit.UserTarget(userReq.ID),
+		After:   map[string]interface{}{"login": userReq.Login},
+	})
 	res.WriteHeader(http.StatusOK)
 }
 
+func (a *App) rehashPassword(ctx context.Context, userID uint64, plain string) {
+	hash, err := a.hasher.Hash(plain)
+	if err != nil {
+		a.logger.Errorf("cannot rehash password: %v", err)
+		return
+	}
+
+	if err := a.store.UpdateUserPasswordHash(ctx, userID, hash); err != nil {
+		a.logger.Errorf("cannot save rehashed password: %v", err)
+	}
+}
+
 func (a *App) PutOrder(c *gin.Context) {
 	userID := c.GetUint64(auth.UserIDKey.ToString())
 	req := c.Request
@@ -161,7 +438,7 @@ func (a *App) PutOrder(c *gin.Context) {
 		return
 	}
 
-	if err := a.store.PutOrder(number, userID); err != nil {
+	if err := a.store.PutOrder(c.Request.Context(), number, userID); err != nil {
 		switch {
 		case errors.Is(err, models.ErrOrderHasBeenProcessedByAnotherUser):
 			res.WriteHeader(http.StatusConflict)
@@ -178,6 +455,11 @@ func (a *App) PutOrder(c *gin.Context) {
 		}
 	}
 
+	a.audit.Record(c, audit.Event{
+		ActorID: userID,
+		Action:  audit.ActionOrderUpload,
+		Target:  audit.OrderTarget(number),
+	})
 	res.WriteHeader(http.StatusAccepted)
 }
 
@@ -190,7 +472,7 @@ func (a *App) GetOrders(c *gin.Context) {
 		return
 	}
 
-	orders, err := a.store.GetUserOrders(userID)
+	orders, err := a.store.GetUserOrders(c.Request.Context(), userID)
 	if err != nil {
 		if errors.Is(err, models.ErrUserHasNoItems) {
 			res.WriteHeader(http.StatusNoContent)
@@ -214,7 +496,7 @@ func (a *App) GetWithdrawals(c *gin.Context) {
 		return
 	}
 
-	withdrawals, err := a.store.GetWithdrawals(userID)
+	withdrawals, err := a.store.GetWithdrawals(c.Request.Context(), userID)
 	if err != nil {
 		if errors.Is(err, models.ErrUserHasNoItems) {
 			res.WriteHeader(http.StatusNoContent)
@@ -229,6 +511,30 @@ func (a *App) GetWithdrawals(c *gin.Context) {
 	c.JSON(http.StatusOK, withdrawals)
 }
 
+//nolint:dupl // code deduplication will lead to bad code extending in future
+func (a *App) GetBalanceHistory(c *gin.Context) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	history, err := a.store.GetBalanceHistory(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrUserHasNoItems) {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		a.logger.Errorf("error getting balance history: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
 func (a *App) GetBalance(c *gin.Context) {
 	userID := c.GetUint64(auth.UserIDKey.ToString())
 	res := c.Writer
@@ -237,7 +543,7 @@ func (a *App) GetBalance(c *gin.Context) {
 		return
 	}
 
-	balance, err := a.store.GetUserBalance(userID)
+	balance, err := a.store.GetUserBalance(c.Request.Context(), userID)
 	if err != nil {
 		a.logger.Errorf("Error getting user balance: %v", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -274,21 +580,79 @@ func (a *App) BalanceWithdraw(c *gin.Context) {
 		return
 	}
 
-	if err := a.store.CreateWithdraw(userID, withdrawRequest); err != nil {
+	if !a.requireWithdrawSecondFactor(c, userID) {
+		return
+	}
+
+	decision, err := a.evaluateWithdrawRisk(c, userID, withdrawRequest.Sum)
+	if err != nil {
+		a.logger.Errorf("cant evaluate withdraw risk: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	status := models.WithdrawProcessed
+	switch decision {
+	case risk.Deny:
+		a.audit.Record(c, audit.Event{
+			ActorID: userID,
+			Action:  audit.ActionWithdrawDenied,
+			Target:  audit.OrderTarget(withdrawRequest.Order),
+			After:   withdrawRequest,
+		})
+		c.JSON(http.StatusForbidden, models.ErrorSchema{Error: "withdraw_denied"})
+		return
+	case risk.Review:
+		status = models.WithdrawPending
+	}
+
+	if err := a.store.CreateWithdraw(c.Request.Context(), userID, withdrawRequest, status); err != nil {
 		if errors.Is(err, store.ErrNotEnoughAmount) {
 			res.WriteHeader(http.StatusPaymentRequired)
 			return
 		}
+		if status, code, ok := withdrawLimitError(err); ok {
+			c.JSON(status, models.ErrorSchema{Error: code})
+			return
+		}
 		a.logger.Errorf("cant save withdraw: %v", err)
 		res.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	a.audit.Record(c, audit.Event{
+		ActorID: userID,
+		Action:  audit.ActionWithdraw,
+		Target:  audit.OrderTarget(withdrawRequest.Order),
+		After:   map[string]interface{}{"withdraw": withdrawRequest, "status": status},
+	})
+	if status == models.WithdrawPending {
+		res.WriteHeader(http.StatusAccepted)
+		return
+	}
 	res.WriteHeader(http.StatusOK)
 }
 
+// withdrawLimitError maps a violated withdrawal rule to the response status and error code.
+func withdrawLimitError(err error) (int, string, bool) {
+	switch {
+	case errors.Is(err, store.ErrWithdrawBelowMin):
+		return http.StatusBadRequest, "withdraw_below_min", true
+	case errors.Is(err, store.ErrWithdrawAboveMax):
+		return http.StatusBadRequest, "withdraw_above_max", true
+	case errors.Is(err, store.ErrWithdrawDailyLimit):
+		return http.StatusForbidden, "daily_limit_exceeded", true
+	case errors.Is(err, store.ErrWithdrawMonthlyLimit):
+		return http.StatusForbidden, "monthly_limit_exceeded", true
+	case errors.Is(err, store.ErrWithdrawRateLimit):
+		return http.StatusTooManyRequests, "withdraw_rate_exceeded", true
+	default:
+		return 0, "", false
+	}
+}
+
 func (a *App) Ping(c *gin.Context) {
-	if err := a.store.Ping(); err != nil {
+	if err := a.store.Ping(c.Request.Context()); err != nil {
 		a.logger.Errorf("Error opening connection to DB: %v", err)
 		c.Writer.WriteHeader(http.StatusInternalServerError)
 		return
@@ -2,40 +2,66 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/rawen554/go-loyal/internal/adapters/accrual"
 	originalStore "github.com/rawen554/go-loyal/internal/adapters/store"
 	"github.com/rawen554/go-loyal/internal/adapters/store/mocks"
 	"github.com/rawen554/go-loyal/internal/config"
+	"github.com/rawen554/go-loyal/internal/middleware/auth"
+	"github.com/rawen554/go-loyal/internal/middleware/signature"
 	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/rawen554/go-loyal/internal/risk"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
+type prefixMatcher string
+
+func (m prefixMatcher) Matches(x interface{}) bool {
+	s, ok := x.(string)
+	return ok && strings.HasPrefix(s, string(m))
+}
+
+func (m prefixMatcher) String() string {
+	return "has prefix " + string(m)
+}
+
 func TestLogin(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 	gomock.InOrder(
-		store.EXPECT().GetUser(gomock.Any()).Return(
+		store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(
 			&models.User{
 				Login:    "a",
 				Password: "$2a$07$me7lXx6x3fQpcrqxjYGa.eyFLQlwnZMI1kxCK8P90HCdUtol92936",
 			}, nil),
-		store.EXPECT().GetUser(gomock.Any()).Return(nil, originalStore.ErrLoginNotFound),
+		store.EXPECT().UpdateUserPasswordHash(gomock.Any(), gomock.Any(), prefixMatcher("$argon2id$")).Return(nil),
+		store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, models.ErrLoginNotFound),
 	)
 
-	app := NewApp(config.GetDummy(), store, zap.L().Sugar())
+	app, err := NewApp(config.GetDummy(), store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
 	r, err := app.SetupRouter()
 	if err != nil {
 		t.Error(err)
@@ -105,13 +131,17 @@ func TestRegister(t *testing.T) {
 	defer ctrl.Finish()
 
 	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 	gomock.InOrder(
-		store.EXPECT().CreateUser(gomock.Any()).Return(int64(1), nil),
-		store.EXPECT().CreateUser(gomock.Any()).Return(int64(0), originalStore.ErrDuplicateLogin),
+		store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(int64(1), nil),
+		store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(int64(0), originalStore.ErrDuplicateLogin),
 	)
 
-	app := NewApp(config.GetDummy(), store, zap.L().Sugar())
+	app, err := NewApp(config.GetDummy(), store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
 	r, err := app.SetupRouter()
 	if err != nil {
 		t.Error(err)
@@ -177,3 +207,1089 @@ func TestRegister(t *testing.T) {
 		}
 	}
 }
+
+func TestTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		proxies []string
+		ip      string
+	}{
+		{name: "Forwarded header is ignored by default", ip: "127.0.0.1"},
+		{name: "Forwarded header of a trusted proxy", proxies: []string{"127.0.0.1"}, ip: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		ctrl := gomock.NewController(t)
+		store := mocks.NewMockStore(ctrl)
+		store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *models.User) (int64, error) {
+				require.Equal(t, tt.ip, u.RegistrationIP, tt.name)
+				return 1, nil
+			})
+
+		cfg := config.GetDummy()
+		cfg.TrustedProxies = tt.proxies
+		app, err := NewApp(cfg, store, zap.L().Sugar())
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := app.SetupRouter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(r)
+
+		body, err := json.Marshal(models.UserCredentialsSchema{Login: "a", Password: "b"})
+		if err != nil {
+			t.Error(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/register", bytes.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, http.StatusOK, res.StatusCode, tt.name)
+
+		srv.Close()
+		ctrl.Finish()
+	}
+}
+
+func TestLoginBruteForce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, models.ErrLoginNotFound).Times(1)
+
+	app, err := NewApp(config.GetDummy(), store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url, err := url.JoinPath(srv.URL, "/api/user/login")
+	if err != nil {
+		t.Error(err)
+	}
+
+	b, err := json.Marshal(models.UserCredentialsSchema{Login: "a", Password: "b"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		status     int
+	}{
+		{
+			name:   "Wrong credentials",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:       "Retry before delay expired",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		res, err := srv.Client().Post(url, "application/json", bytes.NewBuffer(b))
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+		require.Equal(t, tt.retryAfter, res.Header.Get("Retry-After"), tt.name)
+	}
+}
+
+func TestRequestPasswordResetThrottled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(nil, models.ErrLoginNotFound).Times(2)
+
+	cfg := config.GetDummy()
+	cfg.PasswordResetMax = 2
+	app, err := NewApp(cfg, store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url, err := url.JoinPath(srv.URL, "/api/user/password/reset")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, status := range []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests} {
+		res, err := srv.Client().Post(url, "application/json", strings.NewReader(`{"login": "a"}`))
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, status, res.StatusCode)
+	}
+}
+
+func TestLoginPending2FA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Return(
+		&models.User{
+			ID:          1,
+			Login:       "a",
+			Password:    "$2a$07$me7lXx6x3fQpcrqxjYGa.eyFLQlwnZMI1kxCK8P90HCdUtol92936",
+			TOTPEnabled: true,
+		}, nil)
+	store.EXPECT().UpdateUserPasswordHash(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+	app, err := NewApp(config.GetDummy(), store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	url, err := url.JoinPath(srv.URL, "/api/user/login")
+	if err != nil {
+		t.Error(err)
+	}
+
+	b, err := json.Marshal(models.UserCredentialsSchema{Login: "a", Password: "b"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	res, err := srv.Client().Post(url, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		t.Error(err)
+	}
+	var status models.LoginStatusSchema
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Error(err)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Error(err)
+	}
+
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	require.Equal(t, "2fa_required", status.Status)
+	require.Contains(t, res.Header.Get("Set-Cookie"), "jwt-2fa-pending")
+	require.NotContains(t, res.Header.Get("Set-Cookie"), "jwt-token")
+}
+
+func TestAdminRequiresRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := config.GetDummy()
+	user := &models.User{ID: 1, Login: "user", Role: models.RoleUser}
+	support := &models.User{ID: 2, Login: "support", Role: models.RoleSupport}
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), &models.User{ID: user.ID}).Return(user, nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), &models.User{ID: support.ID}).Return(support, nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), &models.User{Login: user.Login}).Return(user, nil)
+
+	app, err := NewApp(cfg, store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		user   *models.User
+		name   string
+		url    string
+		method string
+		status int
+	}{
+		{
+			name:   "User cannot access admin API",
+			user:   user,
+			url:    "/api/admin/users?login=user",
+			method: http.MethodGet,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "Support looks up user",
+			user:   support,
+			url:    "/api/admin/users?login=user",
+			method: http.MethodGet,
+			status: http.StatusOK,
+		},
+		{
+			name:   "Support cannot change roles",
+			user:   support,
+			url:    "/api/admin/users/1/role",
+			method: http.MethodPut,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "Support cannot adjust own balance",
+			user:   support,
+			url:    "/api/admin/users/2/balance",
+			method: http.MethodPost,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "Token issued before roles stays valid as a user token",
+			user:   &models.User{ID: user.ID, Login: user.Login},
+			url:    "/api/admin/users?login=user",
+			method: http.MethodGet,
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		token, err := auth.BuildJWTString(tt.user, cfg.Key)
+		if err != nil {
+			t.Error(err)
+		}
+
+		req, err := http.NewRequest(tt.method, srv.URL+tt.url, http.NoBody)
+		if err != nil {
+			t.Error(err)
+		}
+		req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+	}
+}
+
+func TestBalanceTransfer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := config.GetDummy()
+	user := &models.User{ID: 1, Login: "user", Role: models.RoleUser}
+	transfer := models.TransferSchema{Login: "family", Sum: 100}
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), &models.User{ID: user.ID}).Return(user, nil).AnyTimes()
+	store.EXPECT().GetAuditEvents(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	gomock.InOrder(
+		store.EXPECT().CreateTransfer(gomock.Any(), user.ID, transfer, "key-1").
+			Return(&models.Transfer{ID: 1, SenderID: user.ID, RecipientID: 2, Sum: 100, Recipient: "family"}, nil),
+		store.EXPECT().CreateTransfer(gomock.Any(), user.ID, transfer, "key-2").
+			Return(nil, originalStore.ErrNotEnoughAmount),
+		store.EXPECT().CreateTransfer(gomock.Any(), user.ID, transfer, "key-3").
+			Return(nil, originalStore.ErrTransferLimitExceeded),
+		store.EXPECT().CreateTransfer(gomock.Any(), user.ID, transfer, "key-4").
+			Return(nil, originalStore.ErrWithdrawDailyLimit),
+		store.EXPECT().CreateTransfer(gomock.Any(), user.ID, transfer, "key-1").
+			Return(nil, originalStore.ErrIdempotencyKeyReused),
+	)
+
+	app, err := NewApp(cfg, store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	token, err := auth.BuildJWTString(user, cfg.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		body   models.TransferSchema
+		name   string
+		key    string
+		status int
+	}{
+		{name: "Transfer points", body: transfer, key: "key-1", status: http.StatusOK},
+		{name: "Zero sum", body: models.TransferSchema{Login: "family"}, key: "key-0", status: http.StatusBadRequest},
+		{name: "Not enough points", body: transfer, key: "key-2", status: http.StatusPaymentRequired},
+		{name: "Daily limit exceeded", body: transfer, key: "key-3", status: http.StatusForbidden},
+		{name: "Daily withdrawal limit exceeded", body: transfer, key: "key-4", status: http.StatusForbidden},
+		{name: "Idempotency key reused", body: transfer, key: "key-1", status: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		body, err := json.Marshal(tt.body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/balance/transfer", bytes.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set(IdempotencyKeyHeader, tt.key)
+		req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+	}
+}
+
+func TestBalanceTransferRisk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.GetDummy()
+	user := &models.User{ID: 1, Login: "user", Role: models.RoleUser}
+	transfer := models.TransferSchema{Login: "family", Sum: 100}
+
+	tests := []struct {
+		name     string
+		decision risk.Decision
+		status   int
+	}{
+		{name: "Allowed", decision: risk.Allow, status: http.StatusOK},
+		{name: "Suspicious transfers cannot wait for review", decision: risk.Review, status: http.StatusForbidden},
+		{name: "Denied", decision: risk.Deny, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		ctrl := gomock.NewController(t)
+		store := mocks.NewMockStore(ctrl)
+		store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		store.EXPECT().GetUser(gomock.Any(), &models.User{ID: user.ID}).Return(user, nil).AnyTimes()
+		store.EXPECT().GetAuditEvents(gomock.Any(), gomock.Any()).Return(nil, nil)
+		if tt.decision == risk.Allow {
+			store.EXPECT().CreateTransfer(gomock.Any(), user.ID, transfer, "").
+				Return(&models.Transfer{ID: 1, SenderID: user.ID, RecipientID: 2, Sum: 100}, nil)
+		}
+
+		app, err := NewApp(cfg, store, zap.L().Sugar(), WithRiskEvaluator(staticRisk(tt.decision)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := app.SetupRouter()
+		if err != nil {
+			t.Error(err)
+		}
+		srv := httptest.NewServer(r)
+
+		token, err := auth.BuildJWTString(user, cfg.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := json.Marshal(transfer)
+		if err != nil {
+			t.Error(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/balance/transfer", bytes.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+
+		srv.Close()
+		ctrl.Finish()
+	}
+}
+
+func TestRegisterReferral(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	code := "ABCDEFGH"
+	referrer := &models.User{ID: 1, Login: "referrer", ReferralCode: &code}
+	unknown := "UNKNOWN1"
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	gomock.InOrder(
+		store.EXPECT().GetUser(gomock.Any(), &models.User{ReferralCode: &code}).Return(referrer, nil),
+		store.EXPECT().CreateReferredUser(gomock.Any(), gomock.Any(), referrer.ID).
+			DoAndReturn(func(_ context.Context, u *models.User, _ uint64) (*models.Referral, error) {
+				u.ID = 2
+				return &models.Referral{Status: models.ReferralPending}, nil
+			}),
+		store.EXPECT().GetUser(gomock.Any(), &models.User{ReferralCode: &unknown}).
+			Return(nil, models.ErrLoginNotFound),
+	)
+
+	app, err := NewApp(config.GetDummy(), store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		userCreds models.UserCredentialsSchema
+		name      string
+		status    int
+	}{
+		{
+			name:      "Register with referral code",
+			userCreds: models.UserCredentialsSchema{Login: "a", Password: "b", ReferralCode: "abcdefgh"},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "Register with unknown referral code",
+			userCreds: models.UserCredentialsSchema{Login: "c", Password: "d", ReferralCode: unknown},
+			status:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		b, err := json.Marshal(tt.userCreds)
+		if err != nil {
+			t.Error(err)
+		}
+
+		res, err := srv.Client().Post(srv.URL+"/api/user/register", "application/json", bytes.NewBuffer(b))
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+	}
+}
+
+func TestBalanceWithdrawLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := config.GetDummy()
+	user := &models.User{ID: 1, Login: "user", Role: models.RoleUser}
+	withdraw := models.BalanceWithdrawShema{Order: "2377225624", Sum: 100}
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), &models.User{ID: user.ID}).Return(user, nil).AnyTimes()
+	store.EXPECT().GetAuditEvents(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	gomock.InOrder(
+		store.EXPECT().CreateWithdraw(gomock.Any(), user.ID, withdraw, models.WithdrawProcessed).
+			Return(originalStore.ErrNotEnoughAmount),
+		store.EXPECT().CreateWithdraw(gomock.Any(), user.ID, withdraw, models.WithdrawProcessed).
+			Return(originalStore.ErrWithdrawAboveMax),
+		store.EXPECT().CreateWithdraw(gomock.Any(), user.ID, withdraw, models.WithdrawProcessed).
+			Return(originalStore.ErrWithdrawDailyLimit),
+		store.EXPECT().CreateWithdraw(gomock.Any(), user.ID, withdraw, models.WithdrawProcessed).
+			Return(originalStore.ErrWithdrawRateLimit),
+	)
+
+	app, err := NewApp(cfg, store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	token, err := auth.BuildJWTString(user, cfg.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		status int
+	}{
+		{name: "Not enough points", status: http.StatusPaymentRequired},
+		{name: "Above maximum", status: http.StatusBadRequest, code: "withdraw_above_max"},
+		{name: "Daily limit", status: http.StatusForbidden, code: "daily_limit_exceeded"},
+		{name: "Hourly rate", status: http.StatusTooManyRequests, code: "withdraw_rate_exceeded"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		body, err := json.Marshal(withdraw)
+		if err != nil {
+			t.Error(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/balance/withdraw", bytes.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		var errBody models.ErrorSchema
+		if tt.code != "" {
+			if err := json.NewDecoder(res.Body).Decode(&errBody); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+		require.Equal(t, tt.code, errBody.Error, tt.name)
+	}
+}
+
+func TestSecondFactorGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := config.GetDummy()
+	cfg.WithdrawRequire2FA = true
+	user := &models.User{
+		ID:          1,
+		Login:       "user",
+		Role:        models.RoleUser,
+		TOTPEnabled: true,
+		TOTPSecret:  "JBSWY3DPEHPK3PXP",
+	}
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().GetUser(gomock.Any(), &models.User{ID: user.ID}).Return(user, nil).AnyTimes()
+
+	app, err := NewApp(cfg, store, zap.L().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	token, err := auth.BuildJWTString(user, cfg.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong code counts as a failed login, so the retry right after it is throttled,
+	// also on another endpoint checking the second factor.
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+	}{
+		{
+			name:   "Wrong withdraw code",
+			url:    "/api/user/balance/withdraw",
+			body:   `{"order": "2377225624", "sum": 100}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "Retry on disable",
+			url:    "/api/user/2fa/disable",
+			body:   `{"code": "not a code"}`,
+			status: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+tt.url, strings.NewReader(tt.body))
+		if err != nil {
+			t.Error(err)
+		}
+		req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+		req.Header.Set(otpCodeHeader, "not a code")
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+	}
+}
+
+type staticRisk risk.Decision
+
+func (d staticRisk) Evaluate(risk.Input) (risk.Decision, error) {
+	return risk.Decision(d), nil
+}
+
+func TestBalanceWithdrawRisk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.GetDummy()
+	user := &models.User{ID: 1, Login: "user", Role: models.RoleUser}
+	withdraw := models.BalanceWithdrawShema{Order: "2377225624", Sum: 100}
+
+	tests := []struct {
+		name     string
+		decision risk.Decision
+		status   int
+	}{
+		{name: "Allowed", decision: risk.Allow, status: http.StatusOK},
+		{name: "Parked for review", decision: risk.Review, status: http.StatusAccepted},
+		{name: "Denied", decision: risk.Deny, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		ctrl := gomock.NewController(t)
+		store := mocks.NewMockStore(ctrl)
+		store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		store.EXPECT().GetUser(gomock.Any(), &models.User{ID: user.ID}).Return(user, nil).AnyTimes()
+		store.EXPECT().GetAuditEvents(gomock.Any(), gomock.Any()).Return(nil, nil)
+		switch tt.decision {
+		case risk.Allow:
+			store.EXPECT().CreateWithdraw(gomock.Any(), user.ID, withdraw, models.WithdrawProcessed).Return(nil)
+		case risk.Review:
+			store.EXPECT().CreateWithdraw(gomock.Any(), user.ID, withdraw, models.WithdrawPending).Return(nil)
+		}
+
+		app, err := NewApp(cfg, store, zap.L().Sugar(), WithRiskEvaluator(staticRisk(tt.decision)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := app.SetupRouter()
+		if err != nil {
+			t.Error(err)
+		}
+		srv := httptest.NewServer(r)
+
+		token, err := auth.BuildJWTString(user, cfg.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := json.Marshal(withdraw)
+		if err != nil {
+			t.Error(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/balance/withdraw", bytes.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+
+		srv.Close()
+		ctrl.Finish()
+	}
+}
+
+type recordRisk struct {
+	in risk.Input
+}
+
+func (r *recordRisk) Evaluate(in risk.Input) (risk.Decision, error) {
+	r.in = in
+	return risk.Allow, nil
+}
+
+func TestBalanceWithdrawRiskAccountAge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := config.GetDummy()
+	registered := time.Now().Add(-time.Hour)
+	withdraw := models.BalanceWithdrawShema{Order: "2377225624", Sum: 100}
+	tests := []struct {
+		user *models.User
+		name string
+		min  time.Duration
+		max  time.Duration
+	}{
+		{
+			name: "Recently registered",
+			user: &models.User{ID: 1, Login: "new", Role: models.RoleUser, CreatedAt: &registered},
+			min:  time.Hour,
+			max:  2 * time.Hour,
+		},
+		{
+			name: "Registered before the time was recorded",
+			user: &models.User{ID: 2, Login: "old", Role: models.RoleUser},
+			min:  cfg.RiskNewAccountAge,
+			max:  time.Duration(math.MaxInt64),
+		},
+	}
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().CreateAuditEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().GetAuditEvents(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	store.EXPECT().CreateWithdraw(gomock.Any(), gomock.Any(), withdraw, models.WithdrawProcessed).
+		Return(nil).AnyTimes()
+
+	evaluator := &recordRisk{}
+	app, err := NewApp(cfg, store, zap.L().Sugar(), WithRiskEvaluator(evaluator))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		store.EXPECT().GetUser(gomock.Any(), &models.User{ID: tt.user.ID}).Return(tt.user, nil).AnyTimes()
+
+		token, err := auth.BuildJWTString(tt.user, cfg.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := json.Marshal(withdraw)
+		if err != nil {
+			t.Error(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/user/balance/withdraw", bytes.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		req.AddCookie(&http.Cookie{Name: auth.CookieName, Value: token})
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, http.StatusOK, res.StatusCode, tt.name)
+		require.GreaterOrEqual(t, evaluator.in.AccountAge, tt.min, tt.name)
+		require.LessOrEqual(t, evaluator.in.AccountAge, tt.max, tt.name)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	breaker := accrual.NewBreaker(accrual.BreakerConfig{Failures: 1, OpenTimeout: time.Hour})
+
+	store := mocks.NewMockStore(ctrl)
+	gomock.InOrder(
+		store.EXPECT().Ping(gomock.Any()).Return(nil),
+		store.EXPECT().Ping(gomock.Any()).Return(nil),
+		store.EXPECT().Ping(gomock.Any()).Return(errors.New("connection refused")),
+	)
+
+	app, err := NewApp(config.GetDummy(), store, zap.L().Sugar(), WithAccrualBreaker(breaker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	failAccrual := accrual.WithBreaker(accrualFunc(func() error {
+		return &accrual.ServerError{StatusCode: http.StatusInternalServerError}
+	}), breaker)
+
+	tests := []struct {
+		before func()
+		want   models.HealthSchema
+		status int
+	}{
+		{
+			want:   models.HealthSchema{Status: models.HealthOK, Database: models.HealthOK, Accrual: "closed"},
+			status: http.StatusOK,
+		},
+		{
+			before: func() {
+				_, _ = failAccrual.GetOrderInfo(context.Background(), "1")
+			},
+			want:   models.HealthSchema{Status: models.HealthDegraded, Database: models.HealthOK, Accrual: "open"},
+			status: http.StatusOK,
+		},
+		{
+			want:   models.HealthSchema{Status: models.HealthDown, Database: models.HealthDown, Accrual: "open"},
+			status: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.before != nil {
+			tt.before()
+		}
+
+		res, err := srv.Client().Get(srv.URL + "/health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got models.HealthSchema
+		err = json.NewDecoder(res.Body).Decode(&got)
+		if closeErr := res.Body.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.status, res.StatusCode)
+		require.Equal(t, tt.want, got)
+	}
+}
+
+func TestHealthAccrualBackends(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStore(ctrl)
+	store.EXPECT().Ping(gomock.Any()).Return(nil).Times(2)
+
+	router := accrual.NewRouter(
+		accrual.Backend{
+			Name:     "eu",
+			Prefixes: []string{"4"},
+			Breaker:  accrual.NewBreaker(accrual.BreakerConfig{Failures: 1, OpenTimeout: time.Hour}),
+			Client: accrualFunc(func() error {
+				return &accrual.ServerError{StatusCode: http.StatusInternalServerError}
+			}),
+		},
+		accrual.Backend{
+			Name:    "default",
+			Breaker: accrual.NewBreaker(accrual.BreakerConfig{Failures: 1}),
+			Client:  accrualFunc(func() error { return accrual.ErrNoOrder }),
+		},
+	)
+
+	app, err := NewApp(config.GetDummy(), store, zap.L().Sugar(), WithAccrualBackendBreakers(router))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		before func()
+		want   models.HealthSchema
+	}{
+		{
+			want: models.HealthSchema{
+				Status:          models.HealthOK,
+				Database:        models.HealthOK,
+				AccrualBackends: map[string]string{"eu": "closed", "default": "closed"},
+			},
+		},
+		{
+			before: func() {
+				_, _ = router.GetOrderInfo(context.Background(), "42")
+			},
+			want: models.HealthSchema{
+				Status:          models.HealthDegraded,
+				Database:        models.HealthOK,
+				AccrualBackends: map[string]string{"eu": "open", "default": "closed"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.before != nil {
+			tt.before()
+		}
+
+		res, err := srv.Client().Get(srv.URL + "/health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got models.HealthSchema
+		err = json.NewDecoder(res.Body).Decode(&got)
+		if closeErr := res.Body.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, tt.want, got)
+	}
+}
+
+type accrualFunc func() error
+
+func (f accrualFunc) GetOrderInfo(context.Context, string) (*accrual.AccrualOrderInfoShema, error) {
+	return nil, f()
+}
+
+type ingesterFunc func(info *accrual.AccrualOrderInfoShema) error
+
+func (f ingesterFunc) ApplyOrderInfo(_ context.Context, info *accrual.AccrualOrderInfoShema) error {
+	return f(info)
+}
+
+func TestPushAccrual(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := config.GetDummy()
+	cfg.AccrualPushSecret = "secret"
+
+	applied := make([]accrual.AccrualOrderInfoShema, 0)
+	ingester := ingesterFunc(func(info *accrual.AccrualOrderInfoShema) error {
+		if info.Order == "404" {
+			return originalStore.ErrOrderNotFound
+		}
+		applied = append(applied, *info)
+		return nil
+	})
+
+	app, err := NewApp(cfg, mocks.NewMockStore(ctrl), zap.L().Sugar(), WithAccrualIngester(ingester))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := app.SetupRouter()
+	if err != nil {
+		t.Error(err)
+	}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	const processed = `{"order":"1","status":"PROCESSED","accrual":500}`
+	tests := []struct {
+		name   string
+		body   string
+		secret string
+		status int
+	}{
+		{name: "applied", body: processed, secret: "secret", status: http.StatusOK},
+		{name: "redelivered", body: processed, secret: "secret", status: http.StatusOK},
+		{name: "unknown order", body: `{"order":"404","status":"PROCESSED"}`, secret: "secret", status: http.StatusNotFound},
+		{name: "malformed", body: `{"order":`, secret: "secret", status: http.StatusBadRequest},
+		{name: "bad signature", body: `{"order":"2","status":"INVALID"}`, secret: "other", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		now := time.Now().Unix()
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/internal/accrual", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(signature.TimestampHeader, strconv.FormatInt(now, 10))
+		req.Header.Set(signature.Header, signature.Sign(tt.secret, now, []byte(tt.body)))
+
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Error(err)
+		}
+		require.Equal(t, tt.status, res.StatusCode, tt.name)
+	}
+
+	require.Len(t, applied, 2)
+	require.Equal(t, accrual.AccrualOrderInfoShema{Order: "1", Status: models.PROCESSED, Accrual: 500}, applied[0])
+}
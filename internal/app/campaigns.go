@@ -0,0 +1,93 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/audit"
+	"github.com/rawen554/go-loyal/internal/campaigns"
+	"github.com/rawen554/go-loyal/internal/middleware/auth"
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+func (a *App) AdminGetCampaigns(c *gin.Context) {
+	list, err := a.store.GetCampaigns(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, models.ErrUserHasNoItems) {
+			c.Writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		a.logger.Errorf("error getting campaigns: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (a *App) AdminCreateCampaign(c *gin.Context) {
+	var campaignReq models.CampaignSchema
+	if err := json.NewDecoder(c.Request.Body).Decode(&campaignReq); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	campaign := models.Campaign{
+		StartsAt:       campaignReq.StartsAt,
+		EndsAt:         campaignReq.EndsAt,
+		Name:           campaignReq.Name,
+		Kind:           campaignReq.Kind,
+		Value:          campaignReq.Value,
+		MinAccrual:     campaignReq.MinAccrual,
+		PerUserCap:     campaignReq.PerUserCap,
+		FirstOrderOnly: campaignReq.FirstOrderOnly,
+		Active:         true,
+	}
+	if err := campaigns.Validate(&campaign); err != nil {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := a.store.CreateCampaign(c.Request.Context(), &campaign); err != nil {
+		a.logger.Errorf("cannot create campaign: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: c.GetUint64(auth.UserIDKey.ToString()),
+		Action:  audit.ActionCampaignCreate,
+		Target:  audit.CampaignTarget(campaign.ID),
+		After:   campaign,
+	})
+	c.JSON(http.StatusOK, campaign)
+}
+
+func (a *App) AdminDisableCampaign(c *gin.Context) {
+	campaignID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || campaignID == 0 {
+		c.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := a.store.DisableCampaign(c.Request.Context(), campaignID); err != nil {
+		if errors.Is(err, models.ErrCampaignNotFound) {
+			c.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		a.logger.Errorf("cannot disable campaign: %v", err)
+		c.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: c.GetUint64(auth.UserIDKey.ToString()),
+		Action:  audit.ActionCampaignDisable,
+		Target:  audit.CampaignTarget(campaignID),
+	})
+	c.Writer.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/adapters/store"
+	"github.com/rawen554/go-loyal/internal/audit"
+	"github.com/rawen554/go-loyal/internal/middleware/auth"
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/rawen554/go-loyal/internal/utils"
+)
+
+const resetTokenSize = 32
+
+func (a *App) ChangePassword(c *gin.Context) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	req := c.Request
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var passwordChange models.PasswordChangeSchema
+	if err := json.NewDecoder(req.Body).Decode(&passwordChange); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if passwordChange.NewPassword == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		a.logger.Errorf("cannot get user: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ip := c.ClientIP()
+	if err := a.loginGuard.Check(c.Request.Context(), u.Login, ip); err != nil {
+		a.abortTooManyAttempts(c, err)
+		return
+	}
+
+	ok, _, err := a.hasher.Verify(passwordChange.CurrentPassword, u.Password)
+	if err != nil {
+		a.logger.Errorf("cannot verify password: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.failLogin(c, u.Login, u.ID)
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	hash, err := a.hasher.Hash(passwordChange.NewPassword)
+	if err != nil {
+		a.logger.Errorf("cannot hash pass: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	u, err = a.store.UpdateUserPassword(c.Request.Context(), userID, hash)
+	if err != nil {
+		a.logger.Errorf("cannot update password: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: userID,
+		Action:  audit.ActionPasswordChange,
+		Target:  audit.UserTarget(userID),
+	})
+
+	if err := a.setAuthCookie(c, u); err != nil {
+		a.logger.Errorf("cannot build jwt string: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+}
+
+// RequestPasswordReset always answers 202 so the response does not reveal whether the login exists.
+func (a *App) RequestPasswordReset(c *gin.Context) {
+	req := c.Request
+	res := c.Writer
+
+	var resetRequest models.PasswordResetRequestSchema
+	if err := json.NewDecoder(req.Body).Decode(&resetRequest); err != nil || resetRequest.Login == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Requests are counted for unknown logins too so that throttling does not reveal which exist.
+	ip := c.ClientIP()
+	if err := a.resetGuard.Check(c.Request.Context(), resetRequest.Login, ip); err != nil {
+		a.abortTooManyAttempts(c, err)
+		return
+	}
+	if _, err := a.resetGuard.Fail(c.Request.Context(), resetRequest.Login, ip); err != nil {
+		a.logger.Errorf("cannot record password reset request: %v", err)
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{Login: resetRequest.Login})
+	if err != nil {
+		if !errors.Is(err, models.ErrLoginNotFound) {
+			a.logger.Errorf("cannot get user: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := utils.GenerateToken(resetTokenSize)
+	if err != nil {
+		a.logger.Errorf("cannot generate reset token: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resetToken := models.PasswordResetToken{
+		UserID:    u.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(a.config.PasswordResetTTL),
+	}
+	if err := a.store.CreatePasswordResetToken(c.Request.Context(), &resetToken); err != nil {
+		a.logger.Errorf("cannot save reset token: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.notifier.SendPasswordReset(u.Login, token, resetToken.ExpiresAt); err != nil {
+		a.logger.Errorf("cannot send reset token: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+func (a *App) ConfirmPasswordReset(c *gin.Context) {
+	req := c.Request
+	res := c.Writer
+
+	var resetConfirm models.PasswordResetConfirmSchema
+	if err := json.NewDecoder(req.Body).Decode(&resetConfirm); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if resetConfirm.Token == "" || resetConfirm.NewPassword == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hash, err := a.hasher.Hash(resetConfirm.NewPassword)
+	if err != nil {
+		a.logger.Errorf("cannot hash pass: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	u, err := a.store.ResetUserPassword(c.Request.Context(), utils.HashToken(resetConfirm.Token), hash)
+	if err != nil {
+		if errors.Is(err, store.ErrResetTokenNotValid) {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		a.logger.Errorf("cannot reset password: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: u.ID,
+		Action:  audit.ActionPasswordReset,
+		Target:  audit.UserTarget(u.ID),
+	})
+
+	if err := a.setAuthCookie(c, u); err != nil {
+		a.logger.Errorf("cannot build jwt string: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+}
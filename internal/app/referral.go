@@ -0,0 +1,38 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/middleware/auth"
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+func (a *App) GetReferrals(c *gin.Context) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		a.logger.Errorf("error getting user: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	referrals, err := a.store.GetReferrals(c.Request.Context(), userID)
+	if err != nil {
+		a.logger.Errorf("error getting referrals: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	schema := models.ReferralsSchema{Referrals: referrals}
+	if u.ReferralCode != nil {
+		schema.Code = *u.ReferralCode
+	}
+	c.JSON(http.StatusOK, schema)
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/audit"
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/rawen554/go-loyal/internal/risk"
+)
+
+func (a *App) evaluateWithdrawRisk(c *gin.Context, userID uint64, sum float64) (risk.Decision, error) {
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		return "", fmt.Errorf("error getting user: %w", err)
+	}
+
+	logins, err := a.store.GetAuditEvents(c.Request.Context(), models.AuditFilter{
+		ActorID: userID,
+		Action:  audit.ActionLogin,
+		Limit:   a.config.RiskLoginHistory,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting recent logins: %w", err)
+	}
+
+	now := time.Now()
+	// Users registered before the registration time was recorded are not new.
+	accountAge := time.Duration(math.MaxInt64)
+	if u.CreatedAt != nil {
+		accountAge = now.Sub(*u.CreatedAt)
+	}
+	decision, err := a.risk.Evaluate(risk.Input{
+		At:           now,
+		User:         u,
+		IP:           c.ClientIP(),
+		RecentLogins: logins,
+		Amount:       sum,
+		AccountAge:   accountAge,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error evaluating risk: %w", err)
+	}
+
+	if decision != risk.Allow {
+		a.logger.Infow("withdrawal flagged", "user_id", userID, "sum", sum, "decision", decision)
+	}
+	return decision, nil
+}
@@ -7,29 +7,50 @@ import (
 	"github.com/rawen554/go-loyal/internal/middleware/auth"
 	"github.com/rawen554/go-loyal/internal/middleware/compress"
 	ginLogger "github.com/rawen554/go-loyal/internal/middleware/logger"
+	"github.com/rawen554/go-loyal/internal/middleware/requestid"
+	"github.com/rawen554/go-loyal/internal/middleware/signature"
+	"github.com/rawen554/go-loyal/internal/models"
 )
 
 const (
-	emptyRoute   = ""
-	userAPIRoute = "/api/user"
+	emptyRoute    = ""
+	userAPIRoute  = "/api/user"
+	adminAPIRoute = "/api/admin"
 )
 
 func (a *App) SetupRouter() (*gin.Engine, error) {
 	r := gin.New()
+	if err := r.SetTrustedProxies(a.config.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("error setting trusted proxies: %w", err)
+	}
 	ginLoggerMiddleware, err := ginLogger.Logger(a.logger)
 	if err != nil {
 		return nil, fmt.Errorf("error creating middleware logger func: %w", err)
 	}
+	r.Use(requestid.RequestID(a.logger))
 	r.Use(ginLoggerMiddleware)
 	r.Use(compress.Compress(a.logger))
 
+	r.GET("/health", a.Health)
 	r.POST("/api/user/register", a.Register)
 	r.POST("/api/user/login", a.Login)
+	r.POST("/api/user/login/2fa", a.LoginSecondFactor)
+	r.POST("/api/user/password/reset", a.RequestPasswordReset)
+	r.POST("/api/user/password/reset/confirm", a.ConfirmPasswordReset)
 
 	protectedUserAPI := r.Group(userAPIRoute)
-	protectedUserAPI.Use(auth.AuthMiddleware(a.config.Key, a.logger))
+	protectedUserAPI.Use(auth.AuthMiddleware(a.config.Key, a.store, a.logger))
 	{
 		protectedUserAPI.GET("withdrawals", a.GetWithdrawals)
+		protectedUserAPI.POST("password", a.ChangePassword)
+		protectedUserAPI.GET("referrals", a.GetReferrals)
+
+		twoFactorAPI := protectedUserAPI.Group("2fa")
+		{
+			twoFactorAPI.POST("enroll", a.EnrollTOTP)
+			twoFactorAPI.POST("confirm", a.ConfirmTOTP)
+			twoFactorAPI.POST("disable", a.DisableTOTP)
+		}
 		ordersAPI := protectedUserAPI.Group("orders")
 		{
 			ordersAPI.POST(emptyRoute, a.PutOrder)
@@ -40,6 +61,54 @@ func (a *App) SetupRouter() (*gin.Engine, error) {
 		{
 			balanceAPI.GET(emptyRoute, a.GetBalance)
 			balanceAPI.POST("withdraw", a.BalanceWithdraw)
+			balanceAPI.POST("transfer", a.BalanceTransfer)
+			balanceAPI.GET("history", a.GetBalanceHistory)
+		}
+	}
+
+	if a.ingester != nil && a.config.AccrualPushSecret != "" {
+		r.POST("/api/internal/accrual",
+			signature.RequireSignature(a.config.AccrualPushSecret, a.config.AccrualPushMaxSkew, a.logger),
+			a.PushAccrual,
+		)
+	}
+
+	adminAPI := r.Group(adminAPIRoute)
+	adminAPI.Use(
+		auth.AuthMiddleware(a.config.Key, a.store, a.logger),
+		auth.RequireRoles(models.RoleSupport, models.RoleAdmin),
+	)
+	{
+		usersAPI := adminAPI.Group("users")
+		{
+			usersAPI.GET(emptyRoute, a.AdminFindUser)
+			usersAPI.GET(":id", a.AdminGetUser)
+			usersAPI.GET(":id/orders", a.AdminGetUserOrders)
+			usersAPI.GET(":id/withdrawals", a.AdminGetUserWithdrawals)
+			usersAPI.POST(":id/balance", a.AdminAdjustBalance)
+			usersAPI.GET(":id/adjustments", a.AdminGetUserAdjustments)
+			usersAPI.PUT(":id/role", auth.RequireRoles(models.RoleAdmin), a.AdminSetUserRole)
+		}
+		adminAPI.GET("audit", auth.RequireRoles(models.RoleAdmin), a.AdminGetAuditEvents)
+
+		withdrawalsAPI := adminAPI.Group("withdrawals")
+		{
+			withdrawalsAPI.GET("pending", a.AdminGetPendingWithdrawals)
+			withdrawalsAPI.POST(":id/approve", auth.RequireRoles(models.RoleAdmin), a.AdminApproveWithdrawal)
+			withdrawalsAPI.POST(":id/reject", auth.RequireRoles(models.RoleAdmin), a.AdminRejectWithdrawal)
+		}
+
+		ordersAPI := adminAPI.Group("orders")
+		{
+			ordersAPI.GET("review", a.AdminGetOrdersForReview)
+			ordersAPI.POST(":number/requeue", auth.RequireRoles(models.RoleAdmin), a.AdminRequeueOrder)
+		}
+
+		campaignsAPI := adminAPI.Group("campaigns")
+		{
+			campaignsAPI.GET(emptyRoute, a.AdminGetCampaigns)
+			campaignsAPI.POST(emptyRoute, auth.RequireRoles(models.RoleAdmin), a.AdminCreateCampaign)
+			campaignsAPI.DELETE(":id", auth.RequireRoles(models.RoleAdmin), a.AdminDisableCampaign)
 		}
 	}
 
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/adapters/store"
+	"github.com/rawen554/go-loyal/internal/audit"
+	"github.com/rawen554/go-loyal/internal/middleware/auth"
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/rawen554/go-loyal/internal/risk"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+func (a *App) BalanceTransfer(c *gin.Context) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var transferRequest models.TransferSchema
+	if err := json.NewDecoder(c.Request.Body).Decode(&transferRequest); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	if transferRequest.Login == "" || transferRequest.Sum <= 0 || len(idempotencyKey) > maxIdempotencyKeyLen {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !a.requireWithdrawSecondFactor(c, userID) {
+		return
+	}
+
+	decision, err := a.evaluateWithdrawRisk(c, userID, transferRequest.Sum)
+	if err != nil {
+		a.logger.Errorf("cant evaluate transfer risk: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// A transfer takes effect at once and cannot wait for a review, so a suspicious one is denied.
+	if decision != risk.Allow {
+		a.audit.Record(c, audit.Event{
+			ActorID: userID,
+			Action:  audit.ActionTransferDenied,
+			Target:  audit.UserTarget(userID),
+			After:   map[string]interface{}{"transfer": transferRequest, "decision": decision},
+		})
+		c.JSON(http.StatusForbidden, models.ErrorSchema{Error: "transfer_denied"})
+		return
+	}
+
+	transfer, err := a.store.CreateTransfer(c.Request.Context(), userID, transferRequest, idempotencyKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrLoginNotFound):
+			res.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, store.ErrSelfTransfer):
+			res.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, store.ErrNotEnoughAmount):
+			res.WriteHeader(http.StatusPaymentRequired)
+		case errors.Is(err, store.ErrTransferLimitExceeded):
+			res.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, store.ErrIdempotencyKeyReused):
+			res.WriteHeader(http.StatusConflict)
+		default:
+			if status, code, ok := withdrawLimitError(err); ok {
+				c.JSON(status, models.ErrorSchema{Error: code})
+				return
+			}
+			a.logger.Errorf("cant save transfer: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: userID,
+		Action:  audit.ActionTransfer,
+		Target:  audit.UserTarget(transfer.RecipientID),
+		After:   transfer,
+	})
+	c.JSON(http.StatusOK, transfer)
+}
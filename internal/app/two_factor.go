@@ -0,0 +1,351 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/adapters/store"
+	"github.com/rawen554/go-loyal/internal/audit"
+	"github.com/rawen554/go-loyal/internal/middleware/auth"
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/rawen554/go-loyal/internal/totp"
+	"github.com/rawen554/go-loyal/internal/utils"
+)
+
+const (
+	totpSkew            = 1
+	recoveryCodesCount  = 10
+	recoveryCodeSize    = 10
+	recoveryCodeGroup   = 4
+	loginStatus2FA      = "2fa_required"
+	otpCodeHeader       = "X-OTP-Code"
+	pendingCookieMaxAge = 300
+)
+
+var errSecondFactorNotValid = errors.New("second factor is not valid")
+
+func (a *App) EnrollTOTP(c *gin.Context) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		a.logger.Errorf("cannot get user: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if u.TOTPEnabled {
+		res.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		a.logger.Errorf("cannot generate totp secret: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.store.SetUserTOTPSecret(c.Request.Context(), userID, secret); err != nil {
+		a.logger.Errorf("cannot save totp secret: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorEnrollmentSchema{
+		Secret: secret,
+		URI:    totp.URI(a.config.TOTPIssuer, u.Login, secret),
+	})
+}
+
+func (a *App) ConfirmTOTP(c *gin.Context) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	req := c.Request
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var codeReq models.TwoFactorCodeSchema
+	if err := json.NewDecoder(req.Body).Decode(&codeReq); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		a.logger.Errorf("cannot get user: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if u.TOTPEnabled {
+		res.WriteHeader(http.StatusConflict)
+		return
+	}
+	if u.TOTPSecret == "" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	step, ok, err := totp.Validate(u.TOTPSecret, codeReq.Code, time.Now(), totpSkew)
+	if err != nil {
+		a.logger.Errorf("cannot validate totp code: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		a.logger.Errorf("cannot generate recovery codes: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.store.EnableUserTOTP(c.Request.Context(), userID, step, hashes); err != nil {
+		a.logger.Errorf("cannot enable totp: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: userID,
+		Action:  audit.ActionTOTPEnable,
+		Target:  audit.UserTarget(userID),
+	})
+
+	c.JSON(http.StatusOK, models.RecoveryCodesSchema{RecoveryCodes: codes})
+}
+
+func (a *App) DisableTOTP(c *gin.Context) {
+	userID := c.GetUint64(auth.UserIDKey.ToString())
+	req := c.Request
+	res := c.Writer
+	if userID == 0 {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var codeReq models.TwoFactorCodeSchema
+	if err := json.NewDecoder(req.Body).Decode(&codeReq); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		a.logger.Errorf("cannot get user: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !u.TOTPEnabled {
+		res.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if !a.checkSecondFactor(c, u, codeReq) {
+		return
+	}
+
+	if err := a.store.DisableUserTOTP(c.Request.Context(), userID); err != nil {
+		a.logger.Errorf("cannot disable totp: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.audit.Record(c, audit.Event{
+		ActorID: userID,
+		Action:  audit.ActionTOTPDisable,
+		Target:  audit.UserTarget(userID),
+	})
+
+	res.WriteHeader(http.StatusOK)
+}
+
+// LoginSecondFactor completes a login started by Login for users with 2FA enabled.
+func (a *App) LoginSecondFactor(c *gin.Context) {
+	req := c.Request
+	res := c.Writer
+
+	cookie, err := c.Cookie(auth.PendingCookieName)
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := auth.GetClaims(cookie, a.config.Key)
+	if err != nil || !claims.Pending2FA {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var codeReq models.TwoFactorCodeSchema
+	if err := json.NewDecoder(req.Body).Decode(&codeReq); err != nil {
+		a.logger.Errorf("body cannot be decoded: %v", err)
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: claims.UserID})
+	if err != nil {
+		if errors.Is(err, models.ErrLoginNotFound) {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		a.logger.Errorf("cannot get user: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if u.TokenVersion != claims.TokenVersion {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	ip := c.ClientIP()
+	if err := a.loginGuard.Check(c.Request.Context(), u.Login, ip); err != nil {
+		a.abortTooManyAttempts(c, err)
+		return
+	}
+
+	if err := a.verifySecondFactor(c.Request.Context(), u, codeReq); err != nil {
+		if errors.Is(err, errSecondFactorNotValid) {
+			a.failLogin(c, u.Login, u.ID)
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		a.logger.Errorf("cannot verify second factor: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.SetCookie(auth.PendingCookieName, "", -1, "", "", false, true)
+	a.completeLogin(c, u)
+}
+
+func (a *App) setPendingCookie(c *gin.Context, u *models.User) error {
+	jwt, err := auth.BuildPendingJWTString(u, a.config.Key)
+	if err != nil {
+		return fmt.Errorf("error building pending jwt: %w", err)
+	}
+	c.SetCookie(auth.PendingCookieName, jwt, pendingCookieMaxAge, "", "", false, true)
+	return nil
+}
+
+// requireWithdrawSecondFactor checks the X-OTP-Code header when withdrawals require 2FA.
+func (a *App) requireWithdrawSecondFactor(c *gin.Context, userID uint64) bool {
+	if !a.config.WithdrawRequire2FA {
+		return true
+	}
+
+	u, err := a.store.GetUser(c.Request.Context(), &models.User{ID: userID})
+	if err != nil {
+		a.logger.Errorf("cannot get user: %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if !u.TOTPEnabled {
+		c.AbortWithStatus(http.StatusForbidden)
+		return false
+	}
+
+	codeReq := models.TwoFactorCodeSchema{Code: c.GetHeader(otpCodeHeader)}
+	return a.checkSecondFactor(c, u, codeReq)
+}
+
+// checkSecondFactor verifies the code of a signed in user. Wrong codes count as failed logins,
+// so guessing codes with a stolen session runs into the same delays and lockout as guessing passwords.
+func (a *App) checkSecondFactor(c *gin.Context, u *models.User, codeReq models.TwoFactorCodeSchema) bool {
+	if err := a.loginGuard.Check(c.Request.Context(), u.Login, c.ClientIP()); err != nil {
+		a.abortTooManyAttempts(c, err)
+		return false
+	}
+
+	err := a.verifySecondFactor(c.Request.Context(), u, codeReq)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errSecondFactorNotValid):
+		a.failAttempt(c, audit.ActionTOTPFailed, u.Login, u.ID)
+		c.AbortWithStatus(http.StatusForbidden)
+	default:
+		a.logger.Errorf("cannot verify second factor: %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+	return false
+}
+
+// verifySecondFactor accepts either a fresh TOTP code or an unused recovery code.
+func (a *App) verifySecondFactor(ctx context.Context, u *models.User, codeReq models.TwoFactorCodeSchema) error {
+	if codeReq.RecoveryCode != "" {
+		err := a.store.UseRecoveryCode(ctx, u.ID, utils.HashToken(normalizeRecoveryCode(codeReq.RecoveryCode)))
+		if err != nil {
+			if errors.Is(err, store.ErrRecoveryCodeNotValid) {
+				return errSecondFactorNotValid
+			}
+			return fmt.Errorf("error using recovery code: %w", err)
+		}
+		return nil
+	}
+
+	step, ok, err := totp.Validate(u.TOTPSecret, codeReq.Code, time.Now(), totpSkew)
+	if err != nil {
+		return fmt.Errorf("error validating totp code: %w", err)
+	}
+	if !ok {
+		return errSecondFactorNotValid
+	}
+
+	if err := a.store.UseTOTPStep(ctx, u.ID, step); err != nil {
+		if errors.Is(err, store.ErrTOTPCodeReused) {
+			return errSecondFactorNotValid
+		}
+		return fmt.Errorf("error using totp code: %w", err)
+	}
+
+	return nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("error reading random bytes: %w", err)
+		}
+
+		raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+		groups := make([]string, 0, len(raw)/recoveryCodeGroup)
+		for j := 0; j < len(raw); j += recoveryCodeGroup {
+			groups = append(groups, raw[j:j+recoveryCodeGroup])
+		}
+
+		codes = append(codes, strings.Join(groups, "-"))
+		hashes = append(hashes, utils.HashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/middleware/requestid"
+	"github.com/rawen554/go-loyal/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	ActionRegister         = "user.register"
+	ActionLogin            = "user.login"
+	ActionLoginFailed      = "user.login_failed"
+	ActionLoginLockout     = "user.login_lockout"
+	ActionPasswordChange   = "user.password_change"
+	ActionPasswordReset    = "user.password_reset"
+	ActionTOTPEnable       = "user.totp_enable"
+	ActionTOTPDisable      = "user.totp_disable"
+	ActionTOTPFailed       = "user.totp_failed"
+	ActionOrderUpload      = "order.upload"
+	ActionWithdraw         = "balance.withdraw"
+	ActionTransfer         = "balance.transfer"
+	ActionWithdrawDenied   = "balance.withdraw_denied"
+	ActionTransferDenied   = "balance.transfer_denied"
+	ActionWithdrawApprove  = "admin.withdraw_approve"
+	ActionWithdrawReject   = "admin.withdraw_reject"
+	ActionAdminAdjustment  = "admin.balance_adjustment"
+	ActionAdminRoleChange  = "admin.role_change"
+	ActionAdminAuditSearch = "admin.audit_search"
+	ActionCampaignCreate   = "admin.campaign_create"
+	ActionCampaignDisable  = "admin.campaign_disable"
+	ActionOrderRequeue     = "admin.order_requeue"
+)
+
+type Store interface {
+	CreateAuditEvent(ctx context.Context, e *models.AuditEvent) error
+}
+
+type Event struct {
+	Before  interface{}
+	After   interface{}
+	Action  string
+	Target  string
+	ActorID uint64
+}
+
+type Recorder struct {
+	store  Store
+	logger *zap.SugaredLogger
+}
+
+func NewRecorder(store Store, logger *zap.SugaredLogger) *Recorder {
+	return &Recorder{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Record stores the event with the request metadata. Failures are logged and never fail the request.
+func (r *Recorder) Record(c *gin.Context, e Event) {
+	event := &models.AuditEvent{
+		ActorID:   e.ActorID,
+		Action:    e.Action,
+		Target:    e.Target,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetString(requestid.Key),
+	}
+
+	var err error
+	if event.Before, err = marshal(e.Before); err != nil {
+		r.logger.Errorf("error marshaling audit event %v: %v", e.Action, err)
+	}
+	if event.After, err = marshal(e.After); err != nil {
+		r.logger.Errorf("error marshaling audit event %v: %v", e.Action, err)
+	}
+
+	if err := r.store.CreateAuditEvent(c.Request.Context(), event); err != nil {
+		r.logger.Errorw("error saving audit event",
+			"error", err,
+			"action", event.Action,
+			"actor_id", event.ActorID,
+			"target", event.Target,
+		)
+	}
+}
+
+func UserTarget(userID uint64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func LoginTarget(login string) string {
+	return "login:" + login
+}
+
+func OrderTarget(number string) string {
+	return "order:" + number
+}
+
+func marshal(v interface{}) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling audit payload: %w", err)
+	}
+	return b, nil
+}
+
+func CampaignTarget(id uint64) string {
+	return fmt.Sprintf("campaign:%d", id)
+}
@@ -0,0 +1,209 @@
+package bruteforce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+
+	loginKeyPrefix = "login:"
+	ipKeyPrefix    = "ip:"
+)
+
+var ErrTooManyAttempts = errors.New("too many login attempts")
+var ErrUnknownStore = errors.New("unknown login attempts store")
+
+type Store interface {
+	GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// UpdateLoginAttempt applies update to the attempt and saves it so that concurrent updates,
+	// also from other instances sharing the store, do not overwrite each other.
+	UpdateLoginAttempt(ctx context.Context, key string, update func(a *models.LoginAttempt)) error
+	DeleteLoginAttempt(ctx context.Context, key string) error
+}
+
+// NewStore returns the attempts store of the kind, StorePostgres uses db so that
+// all instances share the counters.
+func NewStore(kind string, db Store, ttl time.Duration) (Store, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(ttl), nil
+	case StorePostgres:
+		return db, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStore, kind)
+	}
+}
+
+type Config struct {
+	// Scope prefixes the keys so that guards of different actions can share a store.
+	Scope string
+	// MaxLoginFailures and MaxIPFailures lock the key out, zero or less disables the per-login
+	// or per-IP counting altogether.
+	MaxLoginFailures int
+	MaxIPFailures    int
+	Window           time.Duration
+	Lockout          time.Duration
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+}
+
+type TooManyAttemptsError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("retry after: %vs; %v", e.RetryAfter.Seconds(), e.Err)
+}
+
+func (e *TooManyAttemptsError) Unwrap() error {
+	return e.Err
+}
+
+func NewTooManyAttemptsError(retryAfter time.Duration) error {
+	return &TooManyAttemptsError{
+		RetryAfter: retryAfter,
+		Err:        ErrTooManyAttempts,
+	}
+}
+
+// Guard counts failed logins per login and per client IP. Every failure delays
+// the next attempt exponentially, reaching the limit locks the key out.
+type Guard struct {
+	store  Store
+	logger *zap.SugaredLogger
+	now    func() time.Time
+	config Config
+}
+
+func NewGuard(store Store, config Config, logger *zap.SugaredLogger) *Guard {
+	return &Guard{
+		store:  store,
+		config: config,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Check returns TooManyAttemptsError if either the login or the IP is not allowed to try yet.
+func (g *Guard) Check(ctx context.Context, login string, ip string) error {
+	now := g.now()
+	var wait time.Duration
+
+	for _, l := range g.limits(login, ip) {
+		a, err := g.store.GetLoginAttempt(ctx, l.key)
+		if err != nil {
+			return fmt.Errorf("error getting login attempt: %w", err)
+		}
+
+		if d := a.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		return NewTooManyAttemptsError(wait)
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt and reports whether the login or the IP has just been locked out.
+func (g *Guard) Fail(ctx context.Context, login string, ip string) (bool, error) {
+	var locked bool
+	for _, l := range g.limits(login, ip) {
+		keyLocked, err := g.fail(ctx, l.key, l.max)
+		if err != nil {
+			return false, err
+		}
+		locked = locked || keyLocked
+	}
+
+	return locked, nil
+}
+
+func (g *Guard) Succeed(ctx context.Context, login string) error {
+	if err := g.store.DeleteLoginAttempt(ctx, g.loginKey(login)); err != nil {
+		return fmt.Errorf("error resetting login attempts: %w", err)
+	}
+	return nil
+}
+
+func (g *Guard) fail(ctx context.Context, key string, limit int) (bool, error) {
+	now := g.now()
+
+	var (
+		locked  bool
+		attempt models.LoginAttempt
+	)
+	err := g.store.UpdateLoginAttempt(ctx, key, func(a *models.LoginAttempt) {
+		if a.Failures == 0 || now.Sub(a.FirstFailedAt) > g.config.Window {
+			a.Failures = 0
+			a.FirstFailedAt = now
+		}
+		a.Failures++
+
+		locked = a.Failures >= limit
+		if locked {
+			a.LockedUntil = now.Add(g.config.Lockout)
+		} else {
+			a.LockedUntil = now.Add(g.delay(a.Failures))
+		}
+		attempt = *a
+	})
+	if err != nil {
+		return false, fmt.Errorf("error updating login attempt: %w", err)
+	}
+
+	if locked {
+		g.logger.Warnw("login lockout",
+			"key", attempt.Key,
+			"failures", attempt.Failures,
+			"locked_until", attempt.LockedUntil,
+		)
+	}
+
+	return locked, nil
+}
+
+type limit struct {
+	key string
+	max int
+}
+
+// limits returns the keys of the enabled limits of the attempt.
+func (g *Guard) limits(login string, ip string) []limit {
+	limits := make([]limit, 0, 2)
+	if g.config.MaxLoginFailures > 0 {
+		limits = append(limits, limit{key: g.loginKey(login), max: g.config.MaxLoginFailures})
+	}
+	if g.config.MaxIPFailures > 0 {
+		limits = append(limits, limit{key: g.ipKey(ip), max: g.config.MaxIPFailures})
+	}
+	return limits
+}
+
+func (g *Guard) loginKey(login string) string {
+	return g.config.Scope + loginKeyPrefix + login
+}
+
+func (g *Guard) ipKey(ip string) string {
+	return g.config.Scope + ipKeyPrefix + ip
+}
+
+func (g *Guard) delay(failures int) time.Duration {
+	d := float64(g.config.BaseDelay) * math.Pow(2, float64(failures-1))
+	if d > float64(g.config.MaxDelay) {
+		return g.config.MaxDelay
+	}
+	return time.Duration(d)
+}
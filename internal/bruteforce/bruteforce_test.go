@@ -0,0 +1,145 @@
+package bruteforce
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestGuard(now *time.Time) *Guard {
+	g := NewGuard(NewMemoryStore(time.Hour), Config{
+		MaxLoginFailures: 3,
+		MaxIPFailures:    100,
+		Window:           15 * time.Minute,
+		Lockout:          15 * time.Minute,
+		BaseDelay:        time.Second,
+		MaxDelay:         30 * time.Second,
+	}, zap.L().Sugar())
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestGuard(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	ctx := context.Background()
+
+	require.NoError(t, g.Check(ctx, "user", "10.0.0.1"))
+
+	locked, err := g.Fail(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	require.False(t, locked)
+
+	var tooManyAttemptsError *TooManyAttemptsError
+	require.ErrorAs(t, g.Check(ctx, "user", "10.0.0.2"), &tooManyAttemptsError)
+	require.Equal(t, time.Second, tooManyAttemptsError.RetryAfter)
+	require.ErrorAs(t, g.Check(ctx, "other", "10.0.0.1"), &tooManyAttemptsError, "the IP is delayed too")
+
+	now = now.Add(time.Second)
+	require.NoError(t, g.Check(ctx, "user", "10.0.0.1"))
+
+	_, err = g.Fail(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	require.ErrorAs(t, g.Check(ctx, "user", "10.0.0.1"), &tooManyAttemptsError)
+	require.Equal(t, 2*time.Second, tooManyAttemptsError.RetryAfter)
+
+	locked, err = g.Fail(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	require.True(t, locked)
+	require.ErrorAs(t, g.Check(ctx, "user", "10.0.0.3"), &tooManyAttemptsError)
+	require.Equal(t, 15*time.Minute, tooManyAttemptsError.RetryAfter)
+
+	require.NoError(t, g.Succeed(ctx, "user"))
+	require.NoError(t, g.Check(ctx, "user", "10.0.0.3"))
+}
+
+func TestGuardDisabledIPLimit(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	g.config.MaxIPFailures = 0
+	ctx := context.Background()
+
+	// Every login fails from the same IP, only the failing logins get delayed.
+	for _, login := range []string{"a", "b", "c"} {
+		require.NoError(t, g.Check(ctx, login, "10.0.0.1"))
+		locked, err := g.Fail(ctx, login, "10.0.0.1")
+		require.NoError(t, err)
+		require.False(t, locked)
+	}
+	require.NoError(t, g.Check(ctx, "d", "10.0.0.1"))
+}
+
+func TestGuardWindow(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := g.Fail(ctx, "user", "10.0.0.1")
+		require.NoError(t, err)
+	}
+
+	// Failures older than the window are forgotten.
+	now = now.Add(16 * time.Minute)
+	locked, err := g.Fail(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	require.False(t, locked)
+}
+
+func TestGuardConcurrentFailures(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	g := newTestGuard(&now)
+	ctx := context.Background()
+
+	const attempts = 50
+	wg := sync.WaitGroup{}
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := g.Fail(ctx, "user", "10.0.0.1")
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	a, err := g.store.GetLoginAttempt(ctx, ipKeyPrefix+"10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, attempts, a.Failures)
+}
+
+func TestGuardScope(t *testing.T) {
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(time.Hour)
+	config := Config{MaxLoginFailures: 1, MaxIPFailures: 1, Window: time.Hour, Lockout: time.Hour}
+	login := NewGuard(store, config, zap.L().Sugar())
+	config.Scope = "reset:"
+	reset := NewGuard(store, config, zap.L().Sugar())
+	login.now = func() time.Time { return now }
+	reset.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := reset.Fail(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	require.Error(t, reset.Check(ctx, "user", "10.0.0.1"))
+	require.NoError(t, login.Check(ctx, "user", "10.0.0.1"))
+}
+
+func TestNewStore(t *testing.T) {
+	memory := NewMemoryStore(time.Hour)
+
+	s, err := NewStore(StoreMemory, nil, time.Hour)
+	require.NoError(t, err)
+	require.IsType(t, memory, s)
+
+	s, err = NewStore(StorePostgres, memory, time.Hour)
+	require.NoError(t, err)
+	require.Same(t, memory, s)
+
+	_, err = NewStore("redis", memory, time.Hour)
+	require.ErrorIs(t, err, ErrUnknownStore)
+}
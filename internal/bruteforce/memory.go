@@ -0,0 +1,71 @@
+package bruteforce
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+type MemoryStore struct {
+	lastSweep time.Time
+	attempts  map[string]models.LoginAttempt
+	ttl       time.Duration
+	mu        sync.Mutex
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		attempts:  make(map[string]models.LoginAttempt),
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryStore) GetLoginAttempt(_ context.Context, key string) (*models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		return &models.LoginAttempt{Key: key}, nil
+	}
+	return &a, nil
+}
+
+func (m *MemoryStore) UpdateLoginAttempt(_ context.Context, key string, update func(a *models.LoginAttempt)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		a = models.LoginAttempt{Key: key}
+	}
+	update(&a)
+	m.attempts[key] = a
+	m.sweep()
+	return nil
+}
+
+func (m *MemoryStore) DeleteLoginAttempt(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *MemoryStore) sweep() {
+	now := time.Now()
+	if now.Sub(m.lastSweep) < m.ttl {
+		return
+	}
+	m.lastSweep = now
+
+	for key, a := range m.attempts {
+		if a.LockedUntil.Before(now) && now.Sub(a.FirstFailedAt) > m.ttl {
+			delete(m.attempts, key)
+		}
+	}
+}
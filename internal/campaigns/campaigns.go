@@ -0,0 +1,66 @@
+// Package campaigns evaluates promotional campaign rules for processed orders.
+package campaigns
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+var ErrInvalidCampaign = errors.New("invalid campaign")
+
+// Order describes a processed order for rule evaluation.
+type Order struct {
+	ProcessedAt time.Time
+	Accrual     float64
+	// FirstOrder is true when the user has no other processed orders.
+	FirstOrder bool
+	// Granted is the bonus the campaign has already granted to the user.
+	Granted float64
+}
+
+// Validate checks that the campaign rules are consistent.
+func Validate(c *models.Campaign) error {
+	switch {
+	case c.Name == "" || !c.Kind.IsValid():
+		return ErrInvalidCampaign
+	case !c.EndsAt.After(c.StartsAt):
+		return ErrInvalidCampaign
+	case c.Kind == models.CampaignMultiplier && c.Value <= 1:
+		return ErrInvalidCampaign
+	case c.Kind == models.CampaignFixed && c.Value <= 0:
+		return ErrInvalidCampaign
+	case c.MinAccrual < 0 || c.PerUserCap < 0:
+		return ErrInvalidCampaign
+	}
+	return nil
+}
+
+// Bonus returns the points the campaign grants for the order, zero if its rules do not match.
+func Bonus(c *models.Campaign, o Order) float64 {
+	if !c.Active || o.ProcessedAt.Before(c.StartsAt) || !o.ProcessedAt.Before(c.EndsAt) {
+		return 0
+	}
+	if c.FirstOrderOnly && !o.FirstOrder {
+		return 0
+	}
+	if o.Accrual < c.MinAccrual {
+		return 0
+	}
+
+	var bonus float64
+	switch c.Kind {
+	case models.CampaignMultiplier:
+		bonus = o.Accrual * (c.Value - 1)
+	case models.CampaignFixed:
+		bonus = c.Value
+	}
+
+	if c.PerUserCap > 0 {
+		bonus = math.Min(bonus, c.PerUserCap-o.Granted)
+	}
+
+	return math.Max(bonus, 0)
+}
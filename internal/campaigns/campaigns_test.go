@@ -0,0 +1,102 @@
+package campaigns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBonus(t *testing.T) {
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	weekend := &models.Campaign{
+		Name:     "double points",
+		Kind:     models.CampaignMultiplier,
+		Value:    2,
+		StartsAt: start,
+		EndsAt:   start.Add(48 * time.Hour),
+		Active:   true,
+	}
+	firstOrder := &models.Campaign{
+		Name:           "first order",
+		Kind:           models.CampaignFixed,
+		Value:          100,
+		MinAccrual:     50,
+		PerUserCap:     150,
+		FirstOrderOnly: true,
+		StartsAt:       start,
+		EndsAt:         start.Add(720 * time.Hour),
+		Active:         true,
+	}
+
+	tests := []struct {
+		campaign *models.Campaign
+		name     string
+		order    Order
+		want     float64
+	}{
+		{
+			name:     "multiplier within window",
+			campaign: weekend,
+			order:    Order{ProcessedAt: start.Add(time.Hour), Accrual: 300},
+			want:     300,
+		},
+		{
+			name:     "before window",
+			campaign: weekend,
+			order:    Order{ProcessedAt: start.Add(-time.Second), Accrual: 300},
+		},
+		{
+			name:     "window end is exclusive",
+			campaign: weekend,
+			order:    Order{ProcessedAt: start.Add(48 * time.Hour), Accrual: 300},
+		},
+		{
+			name:     "first order",
+			campaign: firstOrder,
+			order:    Order{ProcessedAt: start, Accrual: 50, FirstOrder: true},
+			want:     100,
+		},
+		{
+			name:     "not first order",
+			campaign: firstOrder,
+			order:    Order{ProcessedAt: start, Accrual: 50},
+		},
+		{
+			name:     "below minimum accrual",
+			campaign: firstOrder,
+			order:    Order{ProcessedAt: start, Accrual: 49, FirstOrder: true},
+		},
+		{
+			name:     "capped per user",
+			campaign: firstOrder,
+			order:    Order{ProcessedAt: start, Accrual: 50, FirstOrder: true, Granted: 120},
+			want:     30,
+		},
+		{
+			name:     "cap exhausted",
+			campaign: firstOrder,
+			order:    Order{ProcessedAt: start, Accrual: 50, FirstOrder: true, Granted: 150},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Bonus(tt.campaign, tt.order))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, Validate(&models.Campaign{
+		Name: "double", Kind: models.CampaignMultiplier, Value: 2, StartsAt: start, EndsAt: start.Add(time.Hour),
+	}))
+	assert.ErrorIs(t, Validate(&models.Campaign{
+		Name: "half", Kind: models.CampaignMultiplier, Value: 0.5, StartsAt: start, EndsAt: start.Add(time.Hour),
+	}), ErrInvalidCampaign)
+	assert.ErrorIs(t, Validate(&models.Campaign{
+		Name: "reversed", Kind: models.CampaignFixed, Value: 10, StartsAt: start, EndsAt: start,
+	}), ErrInvalidCampaign)
+}
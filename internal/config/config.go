@@ -1,18 +1,127 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
+	"github.com/rawen554/go-loyal/internal/models"
 )
 
+// AccrualBackend is an accrual system serving orders by number prefix or inclusive range.
+// A backend without prefixes and ranges serves any order. TLS files override the ACCRUAL_TLS_* ones,
+// headers are added to ACCRUAL_HEADERS replacing the ones of the same name.
+type AccrualBackend struct {
+	Headers     map[string]string `json:"headers,omitempty"`
+	Header      http.Header       `json:"-"`
+	Name        string            `json:"name"`
+	Address     string            `json:"address"`
+	TLSCertFile string            `json:"tls_cert_file,omitempty"`
+	TLSKeyFile  string            `json:"tls_key_file,omitempty"`
+	TLSCAFile   string            `json:"tls_ca_file,omitempty"`
+	Prefixes    []string          `json:"prefixes,omitempty"`
+	Ranges      []AccrualRange    `json:"ranges,omitempty"`
+	RPM         int               `json:"rpm,omitempty"`
+	Batch       bool              `json:"batch,omitempty"`
+}
+
+type AccrualRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
 type ServerConfig struct {
 	RunAddr     string `env:"RUN_ADDRESS" envDefault:":8080"`
 	AccrualAddr string `env:"ACCRUAL_SYSTEM_ADDRESS"`
 	DatabaseURI string `env:"DATABASE_URI"`
 	Key         string `env:"KEY" envDefault:"b4952c3809196592c026529df00774e46bfb5be0"`
 	LogLevel    string `env:"LOG_LEVEL" envDefault:"debug"`
+	// TrustedProxies may set X-Forwarded-For, client IPs of other requests are their remote addresses.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+
+	LoginAttemptsStore string        `env:"LOGIN_ATTEMPTS_STORE" envDefault:"memory"`
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES" envDefault:"5"`
+	LoginIPMaxFailures int           `env:"LOGIN_IP_MAX_FAILURES" envDefault:"20"`
+	LoginFailureWindow time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	LoginBaseDelay     time.Duration `env:"LOGIN_BASE_DELAY" envDefault:"1s"`
+	LoginMaxDelay      time.Duration `env:"LOGIN_MAX_DELAY" envDefault:"30s"`
+
+	PasswordResetTTL    time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"30m"`
+	PasswordResetMax    int           `env:"PASSWORD_RESET_MAX" envDefault:"3"`
+	PasswordResetIPMax  int           `env:"PASSWORD_RESET_IP_MAX" envDefault:"10"`
+	PasswordResetWindow time.Duration `env:"PASSWORD_RESET_WINDOW" envDefault:"1h"`
+	ResetNotifier       string        `env:"RESET_NOTIFIER" envDefault:"log"`
+	ResetNotifierFile   string        `env:"RESET_NOTIFIER_FILE" envDefault:"password_resets.log"`
+
+	PasswordHashAlgo string `env:"PASSWORD_HASH_ALGO" envDefault:"argon2id"`
+	Argon2Memory     uint32 `env:"ARGON2_MEMORY" envDefault:"65536"`
+	Argon2Time       uint32 `env:"ARGON2_TIME" envDefault:"3"`
+	Argon2Threads    uint8  `env:"ARGON2_THREADS" envDefault:"2"`
+	BcryptCost       int    `env:"BCRYPT_COST" envDefault:"10"`
+
+	TOTPIssuer         string `env:"TOTP_ISSUER" envDefault:"gophermart"`
+	WithdrawRequire2FA bool   `env:"WITHDRAW_REQUIRE_2FA" envDefault:"false"`
+
+	PointsLifetimeMonths     int           `env:"POINTS_LIFETIME_MONTHS" envDefault:"12"`
+	PointsExpiringSoon       time.Duration `env:"POINTS_EXPIRING_SOON" envDefault:"720h"`
+	PointsExpirationInterval time.Duration `env:"POINTS_EXPIRATION_INTERVAL" envDefault:"1h"`
+
+	LoyaltyTiers      string        `env:"LOYALTY_TIERS"`
+	LoyaltyTierWindow time.Duration `env:"LOYALTY_TIER_WINDOW" envDefault:"8760h"`
+	Tiers             []models.Tier `env:"-"`
+
+	TransferDailySum   float64 `env:"TRANSFER_DAILY_SUM" envDefault:"10000"`
+	TransferDailyCount int64   `env:"TRANSFER_DAILY_COUNT" envDefault:"10"`
+
+	ReferralBonus float64 `env:"REFERRAL_BONUS" envDefault:"100"`
+
+	WithdrawMinSum      float64 `env:"WITHDRAW_MIN_SUM" envDefault:"0"`
+	WithdrawMaxSum      float64 `env:"WITHDRAW_MAX_SUM" envDefault:"0"`
+	WithdrawDailySum    float64 `env:"WITHDRAW_DAILY_SUM" envDefault:"0"`
+	WithdrawMonthlySum  float64 `env:"WITHDRAW_MONTHLY_SUM" envDefault:"0"`
+	WithdrawHourlyCount int64   `env:"WITHDRAW_HOURLY_COUNT" envDefault:"0"`
+
+	RiskEvaluator     string        `env:"RISK_EVALUATOR" envDefault:"rules"`
+	RiskNewAccountAge time.Duration `env:"RISK_NEW_ACCOUNT_AGE" envDefault:"168h"`
+	RiskNewIPWindow   time.Duration `env:"RISK_NEW_IP_WINDOW" envDefault:"24h"`
+	RiskReviewSum     float64       `env:"RISK_REVIEW_SUM" envDefault:"1000"`
+	RiskDenySum       float64       `env:"RISK_DENY_SUM" envDefault:"0"`
+	RiskLoginHistory  int           `env:"RISK_LOGIN_HISTORY" envDefault:"20"`
+
+	UnknownOrderWindow     time.Duration `env:"UNKNOWN_ORDER_WINDOW" envDefault:"24h"`
+	UnknownOrderBackoff    time.Duration `env:"UNKNOWN_ORDER_BACKOFF" envDefault:"30s"`
+	UnknownOrderMaxBackoff time.Duration `env:"UNKNOWN_ORDER_MAX_BACKOFF" envDefault:"1h"`
+
+	AccrualBreakerFailures          int           `env:"ACCRUAL_BREAKER_FAILURES" envDefault:"5"`
+	AccrualBreakerOpenTimeout       time.Duration `env:"ACCRUAL_BREAKER_OPEN_TIMEOUT" envDefault:"30s"`
+	AccrualBreakerHalfOpenSuccesses int           `env:"ACCRUAL_BREAKER_HALF_OPEN_SUCCESSES" envDefault:"1"`
+
+	AccrualBatchSize int  `env:"ACCRUAL_BATCH_SIZE" envDefault:"10"`
+	AccrualRPM       int  `env:"ACCRUAL_RPM" envDefault:"0"`
+	AccrualBatch     bool `env:"ACCRUAL_BATCH" envDefault:"false"`
+
+	AccrualBackendsSpec string           `env:"ACCRUAL_BACKENDS"`
+	AccrualBackends     []AccrualBackend `env:"-"`
+
+	AccrualTLSCertFile string        `env:"ACCRUAL_TLS_CERT_FILE"`
+	AccrualTLSKeyFile  string        `env:"ACCRUAL_TLS_KEY_FILE"`
+	AccrualTLSCAFile   string        `env:"ACCRUAL_TLS_CA_FILE"`
+	AccrualTimeout     time.Duration `env:"ACCRUAL_TIMEOUT" envDefault:"10s"`
+	AccrualHeadersSpec string        `env:"ACCRUAL_HEADERS"`
+	AccrualHeaders     http.Header   `env:"-"`
+	AccrualProxy       string        `env:"ACCRUAL_PROXY"`
+	AccrualProxyURL    *url.URL      `env:"-"`
+
+	AccrualPushSecret  string        `env:"ACCRUAL_PUSH_SECRET"`
+	AccrualPushMaxSkew time.Duration `env:"ACCRUAL_PUSH_MAX_SKEW" envDefault:"5m"`
 }
 
 var config ServerConfig
@@ -29,6 +138,32 @@ func ParseFlags() (*ServerConfig, error) {
 	flag.StringVar(&config.LogLevel, "l", config.LogLevel, "debug | info | warn | error")
 	flag.Parse()
 
+	tiers, err := ParseTiers(config.LoyaltyTiers)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing loyalty tiers: %w", err)
+	}
+	config.Tiers = tiers
+
+	backends, err := ParseAccrualBackends(config.AccrualBackendsSpec)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing accrual backends: %w", err)
+	}
+	config.AccrualBackends = backends
+
+	headers, err := ParseHeaders(config.AccrualHeadersSpec)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing accrual headers: %w", err)
+	}
+	config.AccrualHeaders = headers
+
+	if config.AccrualProxy != "" {
+		proxyURL, err := url.Parse(config.AccrualProxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("malformed accrual proxy %q", config.AccrualProxy)
+		}
+		config.AccrualProxyURL = proxyURL
+	}
+
 	return &config, nil
 }
 
@@ -37,5 +172,186 @@ func GetDummy() *ServerConfig {
 		RunAddr:  ":8080",
 		Key:      "b4952c3809196592c026529df00774e46bfb5be0",
 		LogLevel: "debug",
+
+		LoginAttemptsStore: "memory",
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 20,
+		LoginFailureWindow: 15 * time.Minute,
+		LoginLockout:       15 * time.Minute,
+		LoginBaseDelay:     time.Second,
+		LoginMaxDelay:      30 * time.Second,
+
+		PasswordResetTTL:    30 * time.Minute,
+		PasswordResetMax:    3,
+		PasswordResetIPMax:  10,
+		PasswordResetWindow: time.Hour,
+		ResetNotifier:       "log",
+		ResetNotifierFile:   "password_resets.log",
+
+		PasswordHashAlgo: "argon2id",
+		Argon2Memory:     65536,
+		Argon2Time:       3,
+		Argon2Threads:    2,
+		BcryptCost:       10,
+
+		TOTPIssuer: "gophermart",
+
+		PointsLifetimeMonths:     12,
+		PointsExpiringSoon:       720 * time.Hour,
+		PointsExpirationInterval: time.Hour,
+
+		LoyaltyTierWindow: 8760 * time.Hour,
+
+		TransferDailySum:   10000,
+		TransferDailyCount: 10,
+
+		ReferralBonus: 100,
+
+		RiskEvaluator:     "rules",
+		RiskNewAccountAge: 168 * time.Hour,
+		RiskNewIPWindow:   24 * time.Hour,
+		RiskReviewSum:     1000,
+		RiskLoginHistory:  20,
+
+		UnknownOrderWindow:     24 * time.Hour,
+		UnknownOrderBackoff:    30 * time.Second,
+		UnknownOrderMaxBackoff: time.Hour,
+
+		AccrualBreakerFailures:          5,
+		AccrualBreakerOpenTimeout:       30 * time.Second,
+		AccrualBreakerHalfOpenSuccesses: 1,
+
+		AccrualBatchSize: 10,
+
+		AccrualTimeout: 10 * time.Second,
+
+		AccrualPushMaxSkew: 5 * time.Minute,
+	}
+}
+
+// ParseTiers parses loyalty tiers in the "name:threshold:multiplier,..." form
+// and returns them ordered by threshold.
+func ParseTiers(spec string) ([]models.Tier, error) {
+	tiers := make([]models.Tier, 0)
+	if strings.TrimSpace(spec) == "" {
+		return tiers, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 3 || fields[0] == "" {
+			return nil, fmt.Errorf("malformed tier %q, want name:threshold:multiplier", part)
+		}
+
+		threshold, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("malformed threshold of tier %q", fields[0])
+		}
+		multiplier, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || multiplier <= 0 {
+			return nil, fmt.Errorf("malformed multiplier of tier %q", fields[0])
+		}
+
+		tiers = append(tiers, models.Tier{Name: fields[0], Threshold: threshold, Multiplier: multiplier})
+	}
+
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].Threshold < tiers[j].Threshold
+	})
+
+	return tiers, nil
+}
+
+// ParseAccrualBackends parses a JSON list of accrual backends, e.g.
+// [{"name":"eu","address":"http://eu:8080","prefixes":["4"],"rpm":60},
+// {"name":"us","address":"http://us:8080","ranges":[{"from":"5000","to":"5999"}]}].
+func ParseAccrualBackends(spec string) ([]AccrualBackend, error) {
+	backends := make([]AccrualBackend, 0)
+	if strings.TrimSpace(spec) == "" {
+		return backends, nil
+	}
+
+	if err := json.Unmarshal([]byte(spec), &backends); err != nil {
+		return nil, fmt.Errorf("malformed accrual backends: %w", err)
+	}
+
+	names := make(map[string]bool, len(backends))
+	for i := range backends {
+		b := &backends[i]
+		if b.Name == "" || b.Address == "" {
+			return nil, fmt.Errorf("accrual backend %q must have a name and an address", b.Name)
+		}
+		if names[b.Name] {
+			return nil, fmt.Errorf("duplicate accrual backend %q", b.Name)
+		}
+		names[b.Name] = true
+
+		if b.RPM < 0 {
+			return nil, fmt.Errorf("negative rpm of accrual backend %q", b.Name)
+		}
+		for _, prefix := range b.Prefixes {
+			if !isDigits(prefix) {
+				return nil, fmt.Errorf("malformed prefix %q of accrual backend %q", prefix, b.Name)
+			}
+		}
+		for _, r := range b.Ranges {
+			if !isDigits(r.From) || !isDigits(r.To) {
+				return nil, fmt.Errorf("malformed range %v-%v of accrual backend %q", r.From, r.To, b.Name)
+			}
+		}
+		if (b.TLSCertFile == "") != (b.TLSKeyFile == "") {
+			return nil, fmt.Errorf("tls_cert_file and tls_key_file of accrual backend %q must be set together", b.Name)
+		}
+		if len(b.Headers) > 0 {
+			header, err := newHeader(b.Headers)
+			if err != nil {
+				return nil, fmt.Errorf("malformed headers of accrual backend %q: %w", b.Name, err)
+			}
+			b.Header = header
+		}
+	}
+
+	return backends, nil
+}
+
+// ParseHeaders parses static HTTP headers given as a JSON object,
+// e.g. {"Authorization": "Bearer token", "X-Client": "gophermart"}.
+func ParseHeaders(spec string) (http.Header, error) {
+	if strings.TrimSpace(spec) == "" {
+		return make(http.Header), nil
+	}
+
+	fields := make(map[string]string)
+	if err := json.Unmarshal([]byte(spec), &fields); err != nil {
+		return nil, fmt.Errorf("malformed headers: %w", err)
+	}
+
+	return newHeader(fields)
+}
+
+func newHeader(fields map[string]string) (http.Header, error) {
+	header := make(http.Header, len(fields))
+	for name, value := range fields {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return nil, fmt.Errorf("malformed header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("malformed value of header %q", name)
+		}
+		header.Set(name, value)
+	}
+
+	return header, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
 	}
+	return true
 }
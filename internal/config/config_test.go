@@ -0,0 +1,115 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []models.Tier
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			spec: "",
+			want: []models.Tier{},
+		},
+		{
+			name: "sorted by threshold",
+			spec: "gold:5000:1.1, silver:1000:1.05",
+			want: []models.Tier{
+				{Name: "silver", Threshold: 1000, Multiplier: 1.05},
+				{Name: "gold", Threshold: 5000, Multiplier: 1.1},
+			},
+		},
+		{
+			name:    "missing multiplier",
+			spec:    "silver:1000",
+			wantErr: true,
+		},
+		{
+			name:    "negative multiplier",
+			spec:    "silver:1000:-1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tiers, err := ParseTiers(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tiers)
+		})
+	}
+}
+
+func TestParseAccrualBackends(t *testing.T) {
+	backends, err := ParseAccrualBackends(`[
+		{"name": "eu", "address": "http://eu:8080", "prefixes": ["4"], "rpm": 60},
+		{"name": "us", "address": "http://us:8080", "ranges": [{"from": "500", "to": "9999"}], "batch": true}
+	]`)
+	require.NoError(t, err)
+	assert.Equal(t, []AccrualBackend{
+		{Name: "eu", Address: "http://eu:8080", Prefixes: []string{"4"}, RPM: 60},
+		{Name: "us", Address: "http://us:8080", Ranges: []AccrualRange{{From: "500", To: "9999"}}, Batch: true},
+	}, backends)
+
+	backends, err = ParseAccrualBackends(`[{"name": "eu", "address": "https://eu:8443",
+		"tls_cert_file": "eu.pem", "tls_key_file": "eu-key.pem", "tls_ca_file": "eu-ca.pem",
+		"headers": {"authorization": "Bearer eu"}}]`)
+	require.NoError(t, err)
+	require.Len(t, backends, 1)
+	assert.Equal(t, "eu.pem", backends[0].TLSCertFile)
+	assert.Equal(t, "eu-key.pem", backends[0].TLSKeyFile)
+	assert.Equal(t, "eu-ca.pem", backends[0].TLSCAFile)
+	assert.Equal(t, http.Header{"Authorization": {"Bearer eu"}}, backends[0].Header)
+
+	backends, err = ParseAccrualBackends(" ")
+	require.NoError(t, err)
+	assert.Empty(t, backends)
+
+	for _, spec := range []string{
+		`{"name": "eu"}`,
+		`[{"name": "eu"}]`,
+		`[{"name": "eu", "address": "a"}, {"name": "eu", "address": "b"}]`,
+		`[{"name": "eu", "address": "a", "prefixes": ["4x"]}]`,
+		`[{"name": "eu", "address": "a", "ranges": [{"from": "9x", "to": "500"}]}]`,
+		`[{"name": "eu", "address": "a", "rpm": -1}]`,
+		`[{"name": "eu", "address": "a", "tls_cert_file": "client.pem"}]`,
+		`[{"name": "eu", "address": "a", "headers": {"X Client": "value"}}]`,
+	} {
+		_, err := ParseAccrualBackends(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders(`{"Authorization": "Bearer a:b,c", "x-client": "gophermart"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer a:b,c", headers.Get("Authorization"))
+	assert.Equal(t, "gophermart", headers.Get("X-Client"))
+
+	headers, err = ParseHeaders("")
+	require.NoError(t, err)
+	assert.Empty(t, headers)
+
+	for _, spec := range []string{
+		"Authorization: Bearer token",
+		`{"": "value"}`,
+		`{"X Client": "value"}`,
+		`{"X-Client": "a\r\nX-Injected: b"}`,
+	} {
+		_, err := ParseHeaders(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,49 @@
+package expiration
+
+import (
+	"context"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/adapters/store"
+	"go.uber.org/zap"
+)
+
+type Expirer struct {
+	store    store.Store
+	logger   *zap.SugaredLogger
+	interval time.Duration
+}
+
+func NewExpirer(store store.Store, interval time.Duration, logger *zap.SugaredLogger) *Expirer {
+	return &Expirer{
+		store:    store,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run expires points on every tick until ctx is done.
+func (e *Expirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.expire(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Expirer) expire(ctx context.Context) {
+	expired, err := e.store.ExpirePoints(ctx, time.Now())
+	if err != nil {
+		e.logger.Errorf("error expiring points: %v", err)
+	}
+	if expired > 0 {
+		e.logger.Infof("expired points: %v", expired)
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -8,12 +9,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/rawen554/go-loyal/internal/models"
 	"go.uber.org/zap"
 )
 
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID uint64
+	UserID       uint64
+	TokenVersion uint64
+	Role         models.Role
+	Pending2FA   bool
+}
+
+type UserGetter interface {
+	GetUser(ctx context.Context, u *models.User) (*models.User, error)
 }
 
 type key int
@@ -23,22 +32,46 @@ func (k key) ToString() string {
 }
 
 const (
-	tokenExp   = time.Hour * 3
-	CookieName = "jwt-token"
+	tokenExp          = time.Hour * 3
+	pendingTokenExp   = time.Minute * 5
+	CookieName        = "jwt-token"
+	PendingCookieName = "jwt-2fa-pending"
 )
 
-const UserIDKey key = iota
+const (
+	UserIDKey key = iota
+	RoleKey
+)
 
 var ErrTokenNotValid = errors.New("token is not valid")
 var ErrNoUserInToken = errors.New("no user data in token")
+var ErrTokenRevoked = errors.New("token has been revoked")
 
-func BuildJWTString(userID uint64, key string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+func BuildJWTString(u *models.User, key string) (string, error) {
+	return buildJWTString(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
 		},
-		UserID: userID,
-	})
+		UserID:       u.ID,
+		TokenVersion: u.TokenVersion,
+		Role:         u.Role,
+	}, key)
+}
+
+// BuildPendingJWTString issues a short-lived token proving the password step of a 2FA login.
+func BuildPendingJWTString(u *models.User, key string) (string, error) {
+	return buildJWTString(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(pendingTokenExp)),
+		},
+		UserID:       u.ID,
+		TokenVersion: u.TokenVersion,
+		Pending2FA:   true,
+	}, key)
+}
+
+func buildJWTString(claims Claims, key string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(key))
 	if err != nil {
@@ -48,7 +81,7 @@ func BuildJWTString(userID uint64, key string) (string, error) {
 	return tokenString, nil
 }
 
-func GetUserID(tokenString string, key string) (uint64, error) {
+func GetClaims(tokenString string, key string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (interface{}, error) {
@@ -56,20 +89,41 @@ func GetUserID(tokenString string, key string) (uint64, error) {
 		})
 	if err != nil {
 		if !token.Valid {
-			return 0, ErrTokenNotValid
+			return nil, ErrTokenNotValid
 		} else {
-			return 0, errors.New("parsing error")
+			return nil, errors.New("parsing error")
 		}
 	}
 
 	if claims.UserID == 0 {
-		return 0, ErrNoUserInToken
+		return nil, ErrNoUserInToken
+	}
+	// Tokens issued before roles were introduced carry none, their users could only be regular ones.
+	if claims.Role == "" {
+		claims.Role = models.RoleUser
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
 
-func AuthMiddleware(key string, logger *zap.SugaredLogger) gin.HandlerFunc {
+// CheckTokenVersion rejects tokens issued before the user's sessions were revoked or role was changed.
+func CheckTokenVersion(ctx context.Context, claims *Claims, users UserGetter) error {
+	u, err := users.GetUser(ctx, &models.User{ID: claims.UserID})
+	if err != nil {
+		if errors.Is(err, models.ErrLoginNotFound) {
+			return ErrNoUserInToken
+		}
+		return fmt.Errorf("error getting token user: %w", err)
+	}
+
+	if u.TokenVersion != claims.TokenVersion || u.Role != claims.Role {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+func AuthMiddleware(key string, users UserGetter, logger *zap.SugaredLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		cookie, err := c.Cookie(CookieName)
 		if err != nil {
@@ -78,18 +132,41 @@ func AuthMiddleware(key string, logger *zap.SugaredLogger) gin.HandlerFunc {
 			return
 		}
 
-		userID, err := GetUserID(cookie, key)
+		claims, err := GetClaims(cookie, key)
+		if err == nil && claims.Pending2FA {
+			err = ErrTokenNotValid
+		}
+		if err == nil {
+			err = CheckTokenVersion(c.Request.Context(), claims, users)
+		}
 		if err != nil {
-			if errors.Is(err, ErrNoUserInToken) || errors.Is(err, ErrTokenNotValid) {
+			if errors.Is(err, ErrNoUserInToken) || errors.Is(err, ErrTokenNotValid) || errors.Is(err, ErrTokenRevoked) {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			} else {
+				logger.Errorf("error authorizing request: %v", err)
 				c.AbortWithStatus(http.StatusInternalServerError)
 				return
 			}
 		}
 
-		c.Set(fmt.Sprint(UserIDKey), userID)
+		c.Set(fmt.Sprint(UserIDKey), claims.UserID)
+		c.Set(fmt.Sprint(RoleKey), string(claims.Role))
 		c.Next()
 	}
 }
+
+// RequireRoles must be used after AuthMiddleware.
+func RequireRoles(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := models.Role(c.GetString(RoleKey.ToString()))
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
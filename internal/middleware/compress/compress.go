@@ -19,7 +19,8 @@ const (
 
 type compressWriter struct {
 	gin.ResponseWriter
-	zw *gzip.Writer
+	zw         *gzip.Writer
+	compressed bool
 }
 
 func newCompressWriter(w gin.ResponseWriter) *compressWriter {
@@ -31,6 +32,7 @@ func newCompressWriter(w gin.ResponseWriter) *compressWriter {
 
 func (c *compressWriter) Write(p []byte) (int, error) {
 	if c.Status() == http.StatusOK {
+		c.compressed = true
 		n, err := c.zw.Write(p)
 		if err != nil {
 			return 0, fmt.Errorf("error writing gzipped bytes: %w", err)
@@ -49,7 +51,7 @@ func (c *compressWriter) Write(p []byte) (int, error) {
 }
 
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if c.Status() == http.StatusOK {
+	if statusCode == http.StatusOK {
 		c.Header().Set(contentEncoding, contentEncodingGzip)
 	}
 	c.ResponseWriter.WriteHeader(statusCode)
@@ -57,6 +59,9 @@ func (c *compressWriter) WriteHeader(statusCode int) {
 
 // Close закрывает gzip.Writer и досылает все данные из буфера.
 func (c *compressWriter) Close() error {
+	if !c.compressed {
+		return nil
+	}
 	if err := c.zw.Close(); err != nil {
 		return fmt.Errorf("error closing writer: %w", err)
 	}
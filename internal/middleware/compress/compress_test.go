@@ -0,0 +1,56 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Compress(zap.L().Sugar()))
+	r.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	// A login of a user with 2FA answers 202 with a JSON body, which is written as is.
+	r.GET("/accepted", func(c *gin.Context) {
+		c.JSON(http.StatusAccepted, gin.H{"status": "2fa_required"})
+	})
+
+	tests := []struct {
+		path     string
+		encoding string
+		body     string
+	}{
+		{path: "/ok", encoding: "gzip", body: `{"status":"ok"}`},
+		{path: "/accepted", body: `{"status":"2fa_required"}`},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, http.NoBody)
+		req.Header.Set("Accept-Encoding", "gzip")
+		r.ServeHTTP(w, req)
+
+		res := w.Result()
+		require.Equal(t, tt.encoding, res.Header.Get("Content-Encoding"), tt.path)
+
+		body := io.Reader(res.Body)
+		if tt.encoding == "gzip" {
+			zr, err := gzip.NewReader(res.Body)
+			require.NoError(t, err)
+			body = zr
+		}
+		got, err := io.ReadAll(body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		require.Equal(t, tt.body, string(got), tt.path)
+	}
+}
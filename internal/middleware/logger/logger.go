@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/middleware/requestid"
 	"go.uber.org/zap"
 )
 
@@ -29,6 +30,7 @@ func Logger(logger *zap.SugaredLogger) (gin.HandlerFunc, error) {
 			"Duration", duration,
 			"Status", c.Writer.Status(),
 			"Size", c.Writer.Size(),
+			"RequestID", c.GetString(requestid.Key),
 		)
 		logger.Debugln("Data", string(body))
 	}, nil
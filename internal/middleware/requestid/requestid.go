@@ -0,0 +1,32 @@
+package requestid
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rawen554/go-loyal/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	Header = "X-Request-ID"
+	Key    = "request-id"
+
+	maxLen = 64
+	size   = 16
+)
+
+func RequestID(logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if id == "" || len(id) > maxLen {
+			generated, err := utils.GenerateToken(size)
+			if err != nil {
+				logger.Errorf("error generating request id: %v", err)
+			}
+			id = generated
+		}
+
+		c.Set(Key, id)
+		c.Header(Header, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,68 @@
+package signature
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "secret"
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"order":"1","status":"PROCESSED","accrual":500}`)
+	sentAt := now.Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			timestamp: strconv.FormatInt(sentAt, 10),
+			signature: Sign(secret, sentAt, body),
+			body:      body,
+		},
+		{
+			name:      "tampered body",
+			timestamp: strconv.FormatInt(sentAt, 10),
+			signature: Sign(secret, sentAt, body),
+			body:      []byte(`{"order":"1","status":"PROCESSED","accrual":5000}`),
+			wantErr:   true,
+		},
+		{
+			name:      "wrong secret",
+			timestamp: strconv.FormatInt(sentAt, 10),
+			signature: Sign("other", sentAt, body),
+			body:      body,
+			wantErr:   true,
+		},
+		{
+			name:      "stale",
+			timestamp: strconv.FormatInt(now.Add(-time.Hour).Unix(), 10),
+			signature: Sign(secret, now.Add(-time.Hour).Unix(), body),
+			body:      body,
+			wantErr:   true,
+		},
+		{
+			name:    "missing",
+			body:    body,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, 5*time.Minute, now, tt.timestamp, tt.signature, tt.body)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrSignatureNotValid)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
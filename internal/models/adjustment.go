@@ -0,0 +1,60 @@
+package models
+
+type AdjustmentReason string
+
+const (
+	ReasonGoodwill      AdjustmentReason = "goodwill"
+	ReasonFraudClawback AdjustmentReason = "fraud_clawback"
+	ReasonCorrection    AdjustmentReason = "correction"
+	ReasonOther         AdjustmentReason = "other"
+)
+
+func (r AdjustmentReason) IsValid() bool {
+	switch r {
+	case ReasonGoodwill, ReasonFraudClawback, ReasonCorrection, ReasonOther:
+		return true
+	default:
+		return false
+	}
+}
+
+// BalanceAdjustment is a manual balance change made by support. Rows are never updated or deleted.
+type BalanceAdjustment struct {
+	CreatedAt  OrderTime        `gorm:"default:now()" json:"created_at"`
+	ReasonCode AdjustmentReason `gorm:"size:32;not null" json:"reason_code"`
+	Note       string           `json:"note,omitempty"`
+	User       User             `json:"-"`
+	Operator   User             `json:"-"`
+	ID         uint64           `gorm:"primaryKey" json:"id"`
+	UserID     uint64           `gorm:"index;not null" json:"user_id"`
+	OperatorID uint64           `gorm:"not null" json:"operator_id"`
+	Amount     float64          `gorm:"not null" json:"amount"`
+}
+
+type BalanceAdjustmentSchema struct {
+	ReasonCode AdjustmentReason `json:"reason_code"`
+	Note       string           `json:"note"`
+	Amount     float64          `json:"amount"`
+}
+
+type HistoryEntryType string
+
+const (
+	HistoryAccrual     HistoryEntryType = "accrual"
+	HistoryWithdrawal  HistoryEntryType = "withdrawal"
+	HistoryAdjustment  HistoryEntryType = "adjustment"
+	HistoryExpiration  HistoryEntryType = "expiration"
+	HistoryTransferIn  HistoryEntryType = "transfer_in"
+	HistoryTransferOut HistoryEntryType = "transfer_out"
+	HistoryBonus       HistoryEntryType = "bonus"
+	HistoryReferral    HistoryEntryType = "referral"
+)
+
+type BalanceHistoryEntry struct {
+	CreatedAt    OrderTime        `json:"created_at"`
+	Type         HistoryEntryType `json:"type"`
+	Order        string           `json:"order,omitempty"`
+	Reason       string           `json:"reason,omitempty"`
+	Counterparty string           `json:"counterparty,omitempty"`
+	Amount       float64          `json:"amount"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent records a security or financial event. Rows are never updated or deleted.
+type AuditEvent struct {
+	CreatedAt time.Time       `gorm:"default:now();index" json:"created_at"`
+	Action    string          `gorm:"size:64;index;not null" json:"action"`
+	Target    string          `gorm:"size:255;index" json:"target,omitempty"`
+	IP        string          `gorm:"size:64" json:"ip,omitempty"`
+	UserAgent string          `json:"user_agent,omitempty"`
+	RequestID string          `gorm:"size:64" json:"request_id,omitempty"`
+	Before    json.RawMessage `gorm:"type:jsonb" json:"before,omitempty"`
+	After     json.RawMessage `gorm:"type:jsonb" json:"after,omitempty"`
+	ID        uint64          `gorm:"primaryKey" json:"id"`
+	ActorID   uint64          `gorm:"index" json:"actor_id,omitempty"`
+}
+
+type AuditFilter struct {
+	From    time.Time
+	To      time.Time
+	Action  string
+	Target  string
+	ActorID uint64
+	Limit   int
+	Offset  int
+}
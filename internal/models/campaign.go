@@ -0,0 +1,59 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+type CampaignKind string
+
+const (
+	// CampaignMultiplier grants accrual * (Value - 1) on top of the base accrual.
+	CampaignMultiplier CampaignKind = "multiplier"
+	// CampaignFixed grants Value points per order.
+	CampaignFixed CampaignKind = "fixed"
+)
+
+func (k CampaignKind) IsValid() bool {
+	return k == CampaignMultiplier || k == CampaignFixed
+}
+
+type Campaign struct {
+	StartsAt       time.Time    `gorm:"not null" json:"starts_at"`
+	EndsAt         time.Time    `gorm:"not null" json:"ends_at"`
+	CreatedAt      OrderTime    `gorm:"default:now()" json:"created_at"`
+	Name           string       `gorm:"not null" json:"name"`
+	Kind           CampaignKind `gorm:"size:32;not null" json:"kind"`
+	ID             uint64       `gorm:"primaryKey" json:"id"`
+	Value          float64      `gorm:"not null" json:"value"`
+	MinAccrual     float64      `json:"min_accrual,omitempty"`
+	PerUserCap     float64      `json:"per_user_cap,omitempty"`
+	FirstOrderOnly bool         `json:"first_order_only,omitempty"`
+	Active         bool         `gorm:"default:true" json:"active"`
+}
+
+type CampaignSchema struct {
+	StartsAt       time.Time    `json:"starts_at"`
+	EndsAt         time.Time    `json:"ends_at"`
+	Name           string       `json:"name"`
+	Kind           CampaignKind `json:"kind"`
+	Value          float64      `json:"value"`
+	MinAccrual     float64      `json:"min_accrual"`
+	PerUserCap     float64      `json:"per_user_cap"`
+	FirstOrderOnly bool         `json:"first_order_only"`
+}
+
+// OrderBonus is a campaign bonus credited on top of the base accrual of an order.
+type OrderBonus struct {
+	CreatedAt   OrderTime `gorm:"default:now()" json:"created_at"`
+	OrderNumber string    `gorm:"uniqueIndex:idx_order_bonuses_order_campaign;not null" json:"order"`
+	Order       Order     `gorm:"foreignKey:OrderNumber" json:"-"`
+	Campaign    Campaign  `json:"-"`
+	User        User      `json:"-"`
+	ID          uint64    `gorm:"primaryKey" json:"-"`
+	CampaignID  uint64    `gorm:"uniqueIndex:idx_order_bonuses_order_campaign;not null" json:"campaign_id"`
+	UserID      uint64    `gorm:"index;not null" json:"-"`
+	Amount      float64   `gorm:"not null" json:"amount"`
+}
@@ -0,0 +1,6 @@
+package models
+
+// ErrorSchema tells clients which rule rejected the request.
+type ErrorSchema struct {
+	Error string `json:"error"`
+}
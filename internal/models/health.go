@@ -0,0 +1,17 @@
+package models
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// HealthSchema is the state of the service and its dependencies.
+type HealthSchema struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+	// Accrual is the state of the accrual circuit breaker, if there is one.
+	Accrual string `json:"accrual,omitempty"`
+	// AccrualBackends are the states of the circuit breakers of routed accrual backends, by backend name.
+	AccrualBackends map[string]string `json:"accrual_backends,omitempty"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type LoginAttempt struct {
+	FirstFailedAt time.Time
+	LockedUntil   time.Time
+	Key           string `gorm:"primaryKey;size:255"`
+	Failures      int
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type LotSource string
+
+const (
+	LotSourceOrder      LotSource = "order"
+	LotSourceAdjustment LotSource = "adjustment"
+	LotSourceLegacy     LotSource = "legacy"
+	LotSourceTransfer   LotSource = "transfer"
+	LotSourceCampaign   LotSource = "campaign"
+	LotSourceTier       LotSource = "tier"
+	LotSourceReferral   LotSource = "referral"
+	LotSourceRefund     LotSource = "refund"
+)
+
+// AccrualLot is a portion of points credited at once. Withdrawals consume lots
+// in the order they expire, the expiration job writes off what is left.
+type AccrualLot struct {
+	AccruedAt time.Time `gorm:"default:now()"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	Source    LotSource `gorm:"size:32;not null"`
+	Reference string    `gorm:"size:255"`
+	User      User
+	ID        uint64 `gorm:"primaryKey"`
+	UserID    uint64 `gorm:"index;not null"`
+	Amount    float64
+	Remaining float64
+}
+
+type PointsExpiration struct {
+	ExpiredAt OrderTime  `gorm:"default:now()" json:"expired_at"`
+	User      User       `json:"-"`
+	Lot       AccrualLot `json:"-"`
+	ID        uint64     `gorm:"primaryKey" json:"-"`
+	UserID    uint64     `gorm:"index;not null" json:"-"`
+	LotID     uint64     `json:"-"`
+	Amount    float64    `json:"amount"`
+}
+
+type ExpiringPoints struct {
+	ExpiresAt OrderTime `json:"expires_at"`
+	Amount    float64   `json:"amount"`
+}
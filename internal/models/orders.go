@@ -37,6 +37,17 @@ func (s Status) Value() (driver.Value, error) {
 	return string(s), nil
 }
 
+// ReviewReason explains why an order was taken out of processing until an admin requeues it.
+type ReviewReason string
+
+const (
+	ReviewUnknownToAccrual ReviewReason = "unknown_to_accrual"
+	// ReviewNoAccrualBackend marks orders none of the configured accrual backends serves.
+	ReviewNoAccrualBackend ReviewReason = "no_accrual_backend"
+	// ReviewAccrualRejected marks orders accrual answered with 400 or 422 for.
+	ReviewAccrualRejected ReviewReason = "accrual_rejected"
+)
+
 type OrderTime time.Time
 
 func (ot OrderTime) MarshalJSON() ([]byte, error) {
@@ -51,6 +62,22 @@ type Order struct {
 	User       User      `json:"-"`
 	UserID     uint64    `json:"-"`
 	Accrual    float64   `json:"accrual,omitempty"`
+	// NextLookupAt postpones asking accrual about the order again.
+	NextLookupAt   *time.Time   `gorm:"index" json:"-"`
+	ReviewReason   ReviewReason `gorm:"size:64;not null;default:''" json:"review_reason,omitempty"`
+	LookupAttempts int          `gorm:"not null;default:0" json:"-"`
+	// Bonus is the sum of campaign and tier bonuses credited for the order on top of Accrual.
+	Bonus float64 `gorm:"->;-:migration" json:"bonus,omitempty"`
+}
+
+// ReviewOrderSchema is an order flagged for review, as shown to admins.
+type ReviewOrderSchema struct {
+	UploadedAt     OrderTime    `json:"uploaded_at"`
+	Number         string       `json:"number"`
+	Status         Status       `json:"status"`
+	ReviewReason   ReviewReason `json:"review_reason"`
+	UserID         uint64       `json:"user_id"`
+	LookupAttempts int          `json:"lookup_attempts"`
 }
 
 func (o *Order) BeforeCreate(tx *gorm.DB) (err error) {
@@ -58,10 +85,14 @@ func (o *Order) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
-func (o *Order) AfterUpdate(tx *gorm.DB) (err error) {
-	if o.Status == PROCESSED && o.Accrual > 0 {
-		result := tx.Model(&User{}).Where("id = ?", o.UserID).Update("balance", gorm.Expr("balance + ?", o.Accrual))
-		return result.Error
-	}
-	return
+func (s Status) IsFinal() bool {
+	return s == PROCESSED || s == INVALID
 }
+
+// IsAccrualStatus reports whether s is one of the statuses the accrual system reports.
+func (s Status) IsAccrualStatus() bool {
+	return s == REGISTERED || s == PROCESSING || s == PROCESSED || s == INVALID
+}
+
+// PendingStatuses are the statuses of orders whose accrual is still on the way.
+var PendingStatuses = []Status{NEW, REGISTERED, PROCESSING}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type ReferralStatus string
+
+const (
+	ReferralPending  ReferralStatus = "pending"
+	ReferralRewarded ReferralStatus = "rewarded"
+	ReferralRejected ReferralStatus = "rejected"
+)
+
+const (
+	ReferralRejectSameIP = "same_ip"
+)
+
+// Referral links a referee to the user whose code they registered with.
+// The referrer is rewarded once, when the referee's first order is processed.
+type Referral struct {
+	CreatedAt    OrderTime      `gorm:"default:now()" json:"created_at"`
+	RewardedAt   *time.Time     `json:"rewarded_at,omitempty"`
+	Status       ReferralStatus `gorm:"size:32;not null" json:"status"`
+	RejectReason string         `gorm:"size:32" json:"reject_reason,omitempty"`
+	RefereeLogin string         `gorm:"->;-:migration" json:"login"`
+	Referrer     User           `gorm:"foreignKey:ReferrerID" json:"-"`
+	Referee      User           `gorm:"foreignKey:RefereeID" json:"-"`
+	ID           uint64         `gorm:"primaryKey" json:"-"`
+	ReferrerID   uint64         `gorm:"index;not null" json:"-"`
+	RefereeID    uint64         `gorm:"uniqueIndex;not null" json:"-"`
+	Bonus        float64        `json:"bonus,omitempty"`
+}
+
+type ReferralsSchema struct {
+	Code      string     `json:"code"`
+	Referrals []Referral `json:"referrals"`
+}
@@ -0,0 +1,25 @@
+package models
+
+// Tier is a loyalty level reached by accruing Threshold points within the tier window.
+// Users in the tier get accrual * (Multiplier - 1) on top of the base accrual of their orders.
+type Tier struct {
+	Name       string
+	Threshold  float64
+	Multiplier float64
+}
+
+// BaseTier applies to users who have not reached any configured tier.
+var BaseTier = Tier{Name: "base", Multiplier: 1}
+
+// TierBonus is a tier bonus credited on top of the base accrual of an order.
+type TierBonus struct {
+	CreatedAt   OrderTime `gorm:"default:now()" json:"created_at"`
+	OrderNumber string    `gorm:"uniqueIndex;not null" json:"order"`
+	Order       Order     `gorm:"foreignKey:OrderNumber" json:"-"`
+	Tier        string    `gorm:"size:64;not null" json:"tier"`
+	User        User      `json:"-"`
+	ID          uint64    `gorm:"primaryKey" json:"-"`
+	UserID      uint64    `gorm:"index;not null" json:"-"`
+	Multiplier  float64   `gorm:"not null" json:"multiplier"`
+	Amount      float64   `gorm:"not null" json:"amount"`
+}
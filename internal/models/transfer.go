@@ -0,0 +1,19 @@
+package models
+
+// Transfer moves points from one user to another. Rows are never updated or deleted.
+type Transfer struct {
+	CreatedAt      OrderTime `gorm:"default:now()" json:"created_at"`
+	IdempotencyKey *string   `gorm:"size:255;uniqueIndex:idx_transfers_sender_key" json:"-"`
+	Recipient      string    `gorm:"-" json:"recipient"`
+	SenderUser     User      `gorm:"foreignKey:SenderID" json:"-"`
+	RecipientUser  User      `gorm:"foreignKey:RecipientID" json:"-"`
+	ID             uint64    `gorm:"primaryKey" json:"id"`
+	SenderID       uint64    `gorm:"uniqueIndex:idx_transfers_sender_key;not null" json:"-"`
+	RecipientID    uint64    `gorm:"index;not null" json:"-"`
+	Sum            float64   `gorm:"not null" json:"sum"`
+}
+
+type TransferSchema struct {
+	Login string  `json:"login"`
+	Sum   float64 `json:"sum"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type RecoveryCode struct {
+	UsedAt   *time.Time
+	CodeHash string `gorm:"size:64;index"`
+	User     User
+	ID       uint64 `gorm:"primaryKey"`
+	UserID   uint64 `gorm:"index"`
+}
+
+type TwoFactorEnrollmentSchema struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorCodeSchema struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type RecoveryCodesSchema struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type LoginStatusSchema struct {
+	Status string `json:"status"`
+}
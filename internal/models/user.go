@@ -1,19 +1,106 @@
 package models
 
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrLoginNotFound = errors.New("login not found")
+
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+)
+
+func (r Role) IsValid() bool {
+	return r == RoleUser || r == RoleSupport || r == RoleAdmin
+}
+
+func (r *Role) Scan(value interface{}) error {
+	rv, ok := value.(string)
+	if !ok {
+		return errors.New(fmt.Sprint("Failed to unmarshal Role value: ", value))
+	}
+
+	*r = Role(rv)
+	return nil
+}
+
+func (r Role) Value() (driver.Value, error) {
+	return string(r), nil
+}
+
 type User struct {
-	Login     string  `gorm:"varchar(100);index:idx_login,unique" json:"login"`
-	Password  string  `gorm:"varchar(255);not null"`
-	ID        uint64  `gorm:"primaryKey" json:"id,omitempty"`
-	Balance   float64 `gorm:"default:0" json:"-"`
-	Withdrawn float64 `gorm:"default:0" json:"-"`
+	// CreatedAt is nil for users registered before it was recorded.
+	CreatedAt      *time.Time `json:"-"`
+	ReferralCode   *string    `gorm:"size:16;uniqueIndex" json:"-"`
+	Login          string     `gorm:"varchar(100);index:idx_login,unique" json:"login"`
+	Password       string     `gorm:"varchar(255);not null"`
+	RegistrationIP string     `gorm:"size:64" json:"-"`
+	ID             uint64     `gorm:"primaryKey" json:"id,omitempty"`
+	Balance        float64    `gorm:"default:0" json:"-"`
+	Withdrawn      float64    `gorm:"default:0" json:"-"`
+	TokenVersion   uint64     `gorm:"default:0" json:"-"`
+	TOTPSecret     string     `gorm:"column:totp_secret;size:64" json:"-"`
+	TOTPEnabled    bool       `gorm:"column:totp_enabled;default:false" json:"-"`
+	TOTPLastStep   int64      `gorm:"column:totp_last_step;default:0" json:"-"`
+	Role           Role       `gorm:"size:20;default:user" json:"-"`
+}
+
+type AdminUserSchema struct {
+	Login       string  `json:"login"`
+	Role        Role    `json:"role"`
+	ID          uint64  `json:"id"`
+	Balance     float64 `json:"current"`
+	Withdrawn   float64 `json:"withdrawn"`
+	TOTPEnabled bool    `json:"totp_enabled"`
+}
+
+type UserRoleSchema struct {
+	Role Role `json:"role"`
 }
 
 type UserCredentialsSchema struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty"`
 }
 
 type UserBalanceShema struct {
-	Balance   float64 `gorm:"default:0" json:"current"`
-	Withdrawn float64 `gorm:"default:0" json:"withdrawn"`
+	Expiring     []ExpiringPoints `gorm:"-" json:"expiring,omitempty"`
+	Tier         string           `gorm:"-" json:"tier"`
+	Balance      float64          `gorm:"default:0" json:"current"`
+	Withdrawn    float64          `gorm:"default:0" json:"withdrawn"`
+	ExpiringSoon float64          `gorm:"-" json:"expiring_soon"`
+	Pending      float64          `gorm:"-" json:"pending"`
+	PendingCount int64            `gorm:"-" json:"pending_count"`
+}
+
+type PasswordChangeSchema struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type PasswordResetRequestSchema struct {
+	Login string `json:"login"`
+}
+
+type PasswordResetConfirmSchema struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type PasswordResetToken struct {
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	TokenHash string `gorm:"size:64;uniqueIndex"`
+	User      User
+	ID        uint64 `gorm:"primaryKey"`
+	UserID    uint64
 }
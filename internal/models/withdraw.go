@@ -1,11 +1,22 @@
 package models
 
+type WithdrawStatus string
+
+const (
+	WithdrawProcessed WithdrawStatus = "PROCESSED"
+	// WithdrawPending holds the points until an admin approves or rejects the withdrawal.
+	WithdrawPending  WithdrawStatus = "PENDING"
+	WithdrawRejected WithdrawStatus = "REJECTED"
+)
+
 type Withdraw struct {
-	ProcessedAt OrderTime `gorm:"default:now()" json:"processed_at"`
-	OrderNum    string    `json:"order"`
-	User        User      `json:"-"`
-	UserID      uint64    `gorm:"column:user_id" json:"-"`
-	Sum         float64   `json:"sum"`
+	ProcessedAt OrderTime      `gorm:"default:now()" json:"processed_at"`
+	OrderNum    string         `json:"order"`
+	Status      WithdrawStatus `gorm:"size:32;default:PROCESSED" json:"status"`
+	User        User           `json:"-"`
+	ID          uint64         `gorm:"primaryKey" json:"-"`
+	UserID      uint64         `gorm:"column:user_id" json:"-"`
+	Sum         float64        `json:"sum"`
 }
 
 func (w *Withdraw) TableName() string {
@@ -16,3 +27,12 @@ type BalanceWithdrawShema struct {
 	Order string  `json:"order"`
 	Sum   float64 `json:"sum"`
 }
+
+// PendingWithdrawSchema is a withdrawal waiting for review, as shown to admins.
+type PendingWithdrawSchema struct {
+	ProcessedAt OrderTime `json:"processed_at"`
+	OrderNum    string    `json:"order"`
+	ID          uint64    `json:"id"`
+	UserID      uint64    `json:"user_id"`
+	Sum         float64   `json:"sum"`
+}
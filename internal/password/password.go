@@ -0,0 +1,68 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AlgoArgon2id = "argon2id"
+	AlgoBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded and whether encoded is weaker than the hasher's policy.
+	Verify(password string, encoded string) (ok bool, needsRehash bool, err error)
+}
+
+// Policy hashes new passwords with the configured algorithm and verifies hashes of every supported algorithm.
+type Policy struct {
+	current  Hasher
+	argon2id *Argon2idHasher
+	bcrypt   *BcryptHasher
+}
+
+func NewPolicy(algo string, argon2idParams Argon2idParams, bcryptCost int) (*Policy, error) {
+	p := &Policy{
+		argon2id: NewArgon2idHasher(argon2idParams),
+		bcrypt:   NewBcryptHasher(bcryptCost),
+	}
+
+	switch algo {
+	case AlgoArgon2id:
+		p.current = p.argon2id
+	case AlgoBcrypt:
+		p.current = p.bcrypt
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm: %v", algo)
+	}
+
+	return p, nil
+}
+
+func (p *Policy) Hash(password string) (string, error) {
+	return p.current.Hash(password) //nolint:wrapcheck // hashers wrap their own errors
+}
+
+func (p *Policy) Verify(password string, encoded string) (bool, bool, error) {
+	var h Hasher
+	switch {
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		h = p.argon2id
+	case isBcryptHash(encoded):
+		h = p.bcrypt
+	default:
+		return false, false, ErrUnknownHashFormat
+	}
+
+	ok, needsRehash, err := h.Verify(password, encoded)
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	return ok, needsRehash || h != p.current, nil
+}
@@ -0,0 +1,109 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testArgon2idParams = Argon2idParams{
+	Memory:  1024,
+	Time:    1,
+	Threads: 1,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+func TestPolicyVerify(t *testing.T) {
+	weakBcrypt, err := NewBcryptHasher(4).Hash("secret")
+	require.NoError(t, err)
+
+	weakArgon2id, err := NewArgon2idHasher(Argon2idParams{
+		Memory:  512,
+		Time:    1,
+		Threads: 1,
+		SaltLen: 16,
+		KeyLen:  32,
+	}).Hash("secret")
+	require.NoError(t, err)
+
+	argon2idPolicy, err := NewPolicy(AlgoArgon2id, testArgon2idParams, 5)
+	require.NoError(t, err)
+	bcryptPolicy, err := NewPolicy(AlgoBcrypt, testArgon2idParams, 4)
+	require.NoError(t, err)
+
+	currentArgon2id, err := argon2idPolicy.Hash("secret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		policy      *Policy
+		name        string
+		password    string
+		encoded     string
+		ok          bool
+		needsRehash bool
+	}{
+		{
+			name:     "Current argon2id hash",
+			policy:   argon2idPolicy,
+			password: "secret",
+			encoded:  currentArgon2id,
+			ok:       true,
+		},
+		{
+			name:     "Wrong password",
+			policy:   argon2idPolicy,
+			password: "wrong",
+			encoded:  currentArgon2id,
+		},
+		{
+			name:        "Argon2id with weaker params",
+			policy:      argon2idPolicy,
+			password:    "secret",
+			encoded:     weakArgon2id,
+			ok:          true,
+			needsRehash: true,
+		},
+		{
+			name:        "Bcrypt under argon2id policy",
+			policy:      argon2idPolicy,
+			password:    "secret",
+			encoded:     weakBcrypt,
+			ok:          true,
+			needsRehash: true,
+		},
+		{
+			name:     "Bcrypt with policy cost",
+			policy:   bcryptPolicy,
+			password: "secret",
+			encoded:  weakBcrypt,
+			ok:       true,
+		},
+		{
+			name:        "Argon2id under bcrypt policy",
+			policy:      bcryptPolicy,
+			password:    "secret",
+			encoded:     currentArgon2id,
+			ok:          true,
+			needsRehash: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := tt.policy.Verify(tt.password, tt.encoded)
+			require.NoError(t, err)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.needsRehash, needsRehash)
+		})
+	}
+}
+
+func TestPolicyVerifyUnknownFormat(t *testing.T) {
+	policy, err := NewPolicy(AlgoArgon2id, testArgon2idParams, 4)
+	require.NoError(t, err)
+
+	_, _, err = policy.Verify("secret", "plain")
+	require.ErrorIs(t, err, ErrUnknownHashFormat)
+}
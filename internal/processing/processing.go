@@ -3,6 +3,8 @@ package processing
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/rawen554/go-loyal/internal/adapters/accrual"
@@ -12,19 +14,46 @@ import (
 )
 
 type ProcessingController struct {
-	ordersChan   chan *models.Order
-	store        store.Store
-	accrual      accrual.Accrual
-	logger       *zap.SugaredLogger
-	cooldownChan chan time.Duration
+	ordersChan    chan *models.Order
+	store         store.Store
+	accrual       accrual.Accrual
+	logger        *zap.SugaredLogger
+	cooldownChan  chan time.Duration
+	stop          chan struct{}
+	done          chan struct{}
+	cancel        context.CancelFunc
+	unknownOrders UnknownOrderPolicy
+	batchSize     int
+	stopOnce      sync.Once
+}
+
+type Option func(*ProcessingController)
+
+var ErrInvalidOrderInfo = errors.New("invalid order info")
+
+// WithBatchSize limits how many orders are looked up in one request when the provider supports batches.
+func WithBatchSize(size int) Option {
+	return func(p *ProcessingController) {
+		p.batchSize = size
+	}
 }
 
 const chanLen = 10
 
+// defaultBatchSize is the largest batch of orders looked up at once by providers that support batches.
+const defaultBatchSize = chanLen
+
+// serverErrorCoolDown is the pause after accrual answers with 5xx.
+const serverErrorCoolDown = chanLen * time.Second
+
+// releaseTimeout bounds the store call that returns an interrupted order to NEW.
+const releaseTimeout = 5 * time.Second
+
 func NewProcessingController(
 	store store.Store,
 	accrual accrual.Accrual,
 	logger *zap.SugaredLogger,
+	opts ...Option,
 ) *ProcessingController {
 	ordersChan := make(chan *models.Order, chanLen)
 	cooldownChan := make(chan time.Duration, 1)
@@ -35,76 +64,429 @@ func NewProcessingController(
 		accrual:      accrual,
 		logger:       logger,
 		cooldownChan: cooldownChan,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		batchSize:    defaultBatchSize,
 	}
 
-	go instance.listenOrders()
+	for _, opt := range opts {
+		opt(instance)
+	}
 
 	return instance
 }
 
-func (p *ProcessingController) listenOrders() {
+func (p *ProcessingController) listenOrders(ctx context.Context) {
 	ticker := time.NewTicker(chanLen * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
 		case cooldown := <-p.cooldownChan:
-			time.Sleep(cooldown)
+			if !p.wait(ctx, cooldown) {
+				return
+			}
 			continue
 		case <-ticker.C:
 		}
-		orders, err := p.store.GetUnprocessedOrders()
+		orders, err := p.store.GetUnprocessedOrders(ctx)
 		if err != nil {
 			p.logger.Errorf("error getting unprocessed orders from store: %v", err)
 		}
 		for i := range orders {
-			p.ordersChan <- &orders[i]
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.stop:
+				return
+			case p.ordersChan <- &orders[i]:
+			}
 		}
 	}
 }
 
+// Process starts feeding unprocessed orders and handling them in the background.
+// Cancelling ctx stops processing at once, Shutdown stops it gracefully.
 func (p *ProcessingController) Process(ctx context.Context) {
-	go func(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+
+	feederDone := make(chan struct{})
+	go func() {
+		defer close(feederDone)
+		p.listenOrders(ctx)
+	}()
+
+	go func() {
+		defer close(p.done)
+		defer p.cancel()
+		defer func() {
+			<-feederDone
+			p.releaseQueued()
+		}()
+
 		for {
+			// Stop takes priority over orders already queued.
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+
 			select {
 			case <-ctx.Done():
 				return
+			case <-p.stop:
+				return
 			case o := <-p.ordersChan:
+				p.processOrders(ctx, o)
+			}
+		}
+	}()
+}
 
-				if o.Status == models.NEW {
-					_, err := p.store.UpdateOrder(&models.Order{Number: o.Number, Status: models.PROCESSING})
-					if err != nil {
-						p.logger.Errorf("error updating order from accrual: %w", err)
-						continue
-					}
-				}
+// Shutdown stops the feeder, waits for the order in flight and releases queued orders.
+// If ctx expires first the order in flight is interrupted and returned to NEW.
+// Shutdown must be called after Process.
+func (p *ProcessingController) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
 
-				info, err := p.accrual.GetOrderInfo(o.Number)
-				if err != nil {
-					var serviceBusyError *accrual.ServiceBusyError
-					if errors.As(err, &serviceBusyError) {
-						p.logger.Infof("service busy: %v", serviceBusyError)
-						p.cooldownChan <- serviceBusyError.CoolDown
-						time.Sleep(serviceBusyError.CoolDown)
-						continue
-					}
-					p.logger.Errorf("unhandled error: %v", err)
-					continue
-				}
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-p.done
+		return ctx.Err() //nolint:wrapcheck // the caller's own context error
+	}
+}
+
+// releaseQueued drops orders fetched but not yet handled. They are left untouched
+// in the store, so the next run picks them up again.
+func (p *ProcessingController) releaseQueued() {
+	released := 0
+	for {
+		select {
+		case <-p.ordersChan:
+			released++
+		default:
+			if released > 0 {
+				p.logger.Infof("released queued orders: %v", released)
+			}
+			return
+		}
+	}
+}
+
+// wait sleeps for d and reports false if processing was stopped meanwhile.
+func (p *ProcessingController) wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-p.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// processOrders handles o together with the orders already queued after it, in batches
+// if the accrual provider supports them.
+func (p *ProcessingController) processOrders(ctx context.Context, o *models.Order) {
+	batch, ok := p.accrual.(accrual.BatchAccrual)
+	if !ok || p.batchSize <= 1 {
+		p.processOrder(ctx, o)
+		return
+	}
 
-				if info.Status == models.PROCESSED || info.Status == models.INVALID {
-					_, err := p.store.UpdateOrder(
-						&models.Order{
-							Number:  info.Order,
-							UserID:  o.UserID,
-							Accrual: info.Accrual,
-							Status:  info.Status,
-						})
-					if err != nil {
-						p.logger.Errorf("error updating order: %w", err)
+	orders := []*models.Order{o}
+collect:
+	for len(orders) < p.batchSize {
+		select {
+		case next := <-p.ordersChan:
+			orders = append(orders, next)
+		default:
+			break collect
+		}
+	}
+
+	if len(orders) == 1 {
+		p.processOrder(ctx, o)
+		return
+	}
+	p.processBatch(ctx, batch, orders)
+}
+
+func (p *ProcessingController) processOrder(ctx context.Context, o *models.Order) {
+	if !p.startOrder(ctx, o) {
+		return
+	}
+	p.lookupOrder(ctx, o)
+}
+
+// startOrder marks a NEW order as PROCESSING before it is looked up.
+func (p *ProcessingController) startOrder(ctx context.Context, o *models.Order) bool {
+	if o.Status != models.NEW {
+		return true
+	}
+
+	_, err := p.store.UpdateOrder(ctx, &models.Order{Number: o.Number, Status: models.PROCESSING})
+	if err != nil {
+		p.logger.Errorf("error updating order from accrual: %v", err)
+		return false
+	}
+	return true
+}
+
+func (p *ProcessingController) lookupOrder(ctx context.Context, o *models.Order) {
+	info, err := p.accrual.GetOrderInfo(ctx, o.Number)
+	if err != nil {
+		if ctx.Err() != nil {
+			p.releaseOrder(o)
+			return
+		}
+		p.handleAccrualError(ctx, o, err)
+		return
+	}
+
+	if err := p.applyOrderInfo(ctx, o, info); err != nil {
+		p.logger.Errorf("error applying order info: %v", err)
+	}
+}
+
+func (p *ProcessingController) processBatch(ctx context.Context, batch accrual.BatchAccrual, orders []*models.Order) {
+	started := make([]*models.Order, 0, len(orders))
+	nums := make([]string, 0, len(orders))
+	for _, o := range orders {
+		if p.startOrder(ctx, o) {
+			started = append(started, o)
+			nums = append(nums, o.Number)
+		}
+	}
+	if len(started) == 0 {
+		return
+	}
+
+	infos, err := batch.GetOrdersInfo(ctx, nums)
+	var batchError *accrual.BatchError
+	if err != nil && !errors.As(err, &batchError) {
+		p.handleBatchError(ctx, started, err)
+		return
+	}
+
+	paused := false
+	for _, o := range started {
+		if batchError != nil {
+			if err, ok := batchError.Errs[o.Number]; ok {
+				// An error pausing processing concerns accrual itself, it is handled once for the batch.
+				if pausesProcessing(err) {
+					if paused {
+						continue
 					}
+					paused = true
 				}
+				p.handleAccrualError(ctx, o, err)
+				continue
 			}
 		}
-	}(ctx)
+
+		info, ok := infos[o.Number]
+		if !ok || info == nil {
+			p.handleUnknownOrder(ctx, o, time.Now())
+			continue
+		}
+		if err := p.applyOrderInfo(ctx, o, info); err != nil {
+			p.logger.Errorf("error applying order info: %v", err)
+		}
+	}
+}
+
+// handleBatchError looks the orders up one by one if the batch was rejected as a whole,
+// otherwise the error concerns accrual itself and is handled once for the batch.
+func (p *ProcessingController) handleBatchError(ctx context.Context, orders []*models.Order, err error) {
+	if ctx.Err() != nil {
+		for _, o := range orders {
+			p.releaseOrder(o)
+		}
+		return
+	}
+
+	var (
+		clientError    *accrual.ClientError
+		malformedError *accrual.MalformedResponseError
+	)
+	if errors.As(err, &clientError) || errors.As(err, &malformedError) {
+		p.logger.Warnf("batch lookup of %v orders failed, looking them up one by one: %v", len(orders), err)
+		for _, o := range orders {
+			p.lookupOrder(ctx, o)
+		}
+		return
+	}
+
+	p.handleAccrualError(ctx, orders[0], err)
+}
+
+func (p *ProcessingController) applyOrderInfo(
+	ctx context.Context,
+	o *models.Order,
+	info *accrual.AccrualOrderInfoShema,
+) error {
+	if info.Status == models.REGISTERED || info.Status == models.PROCESSING {
+		if info.Status == o.Status && info.Accrual == o.Accrual {
+			return nil
+		}
+		// Keep the preliminary accrual so it shows up as pending balance.
+		_, err := p.store.UpdateOrder(ctx,
+			&models.Order{
+				Number:  info.Order,
+				Accrual: info.Accrual,
+				Status:  info.Status,
+			})
+		if err != nil {
+			return fmt.Errorf("error updating order: %w", err)
+		}
+		return nil
+	}
+
+	if info.Status == models.PROCESSED || info.Status == models.INVALID {
+		_, err := p.store.UpdateOrder(ctx,
+			&models.Order{
+				Number:  info.Order,
+				UserID:  o.UserID,
+				Accrual: info.Accrual,
+				Status:  info.Status,
+			})
+		if err != nil {
+			return fmt.Errorf("error updating order: %w", err)
+		}
+	}
+	return nil
+}
+
+// ApplyOrderInfo applies a result pushed by accrual the same way as a polled one.
+// Results for finished orders are ignored, so repeated deliveries are harmless.
+func (p *ProcessingController) ApplyOrderInfo(ctx context.Context, info *accrual.AccrualOrderInfoShema) error {
+	if !info.Status.IsAccrualStatus() {
+		return fmt.Errorf("unknown status %q: %w", info.Status, ErrInvalidOrderInfo)
+	}
+
+	o, err := p.store.GetOrder(ctx, info.Order)
+	if err != nil {
+		return fmt.Errorf("error getting order: %w", err)
+	}
+	if o.Status.IsFinal() {
+		return nil
+	}
+
+	return p.applyOrderInfo(ctx, o, info)
+}
+
+// handleAccrualError decides what to do with an order accrual has not answered for.
+// Orders that are not marked stay pending and are retried on the next feed.
+func (p *ProcessingController) handleAccrualError(ctx context.Context, o *models.Order, err error) {
+	var (
+		serviceBusyError *accrual.ServiceBusyError
+		serverError      *accrual.ServerError
+		clientError      *accrual.ClientError
+		malformedError   *accrual.MalformedResponseError
+		breakerOpenError *accrual.BreakerOpenError
+	)
+
+	switch {
+	case errors.As(err, &breakerOpenError) && breakerOpenError.Backend != "":
+		// Only this backend is failing, its orders are picked up again on the next feed.
+		p.logger.Infof("skipping order %v: %v", o.Number, breakerOpenError)
+	case errors.As(err, &breakerOpenError):
+		// Stop feeding until the breaker lets a probe through, the order is picked up again later.
+		if breakerOpenError.Remaining > 0 {
+			p.logger.Infof("accrual circuit breaker is open, pausing for %v", breakerOpenError.Remaining)
+			p.coolDown(ctx, breakerOpenError.Remaining)
+		}
+	case errors.Is(err, accrual.ErrNoOrder):
+		p.handleUnknownOrder(ctx, o, time.Now())
+	case errors.Is(err, accrual.ErrNoBackend):
+		p.logger.Errorw("no accrual backend serves the order, flagging it for review", "order", o.Number)
+		if err := p.store.FlagOrderForReview(ctx, o.Number, models.ReviewNoAccrualBackend); err != nil {
+			p.logger.Errorf("error flagging order for review: %v", err)
+		}
+	case errors.As(err, &serviceBusyError) && serviceBusyError.Backend != "":
+		// Only this backend is busy, its orders are picked up again on the next feed.
+		p.logger.Infof("accrual backend %v is busy, skipping order %v: %v",
+			serviceBusyError.Backend, o.Number, serviceBusyError)
+	case errors.As(err, &serviceBusyError):
+		if errors.Is(err, accrual.ErrNoRetryAfter) {
+			p.logger.Warnf("service busy without valid Retry-After, cooling down for %v", serviceBusyError.CoolDown)
+		} else {
+			p.logger.Infof("service busy: %v", serviceBusyError)
+		}
+		p.coolDown(ctx, serviceBusyError.CoolDown)
+	case errors.As(err, &serverError):
+		p.logger.Warnf("accrual is unavailable, order %v will be retried later: %v", o.Number, serverError)
+		p.coolDown(ctx, serverErrorCoolDown)
+	case errors.As(err, &clientError) && clientError.OrderRejected():
+		// The rejection may come from a misconfigured or misbehaving backend, so leave the decision to an admin.
+		p.logger.Warnf("accrual rejected order %v, flagging it for review: %v", o.Number, clientError)
+		if err := p.store.FlagOrderForReview(ctx, o.Number, models.ReviewAccrualRejected); err != nil {
+			p.logger.Errorf("error flagging order for review: %v", err)
+		}
+	case errors.As(err, &clientError):
+		p.logger.Errorw("accrual rejected the client, check its configuration",
+			"order", o.Number, "status", clientError.StatusCode, "body", clientError.Body)
+	case errors.As(err, &malformedError):
+		p.logger.Errorw("accrual response does not follow the API",
+			"order", o.Number, "status", malformedError.StatusCode, "body", malformedError.Body,
+			"error", malformedError.Err)
+	default:
+		p.logger.Errorf("unhandled error: %v", err)
+	}
+}
+
+// pausesProcessing reports whether handleAccrualError cools processing down for err.
+func pausesProcessing(err error) bool {
+	var (
+		serviceBusyError *accrual.ServiceBusyError
+		serverError      *accrual.ServerError
+		breakerOpenError *accrual.BreakerOpenError
+	)
+
+	switch {
+	case errors.As(err, &breakerOpenError):
+		return breakerOpenError.Backend == ""
+	case errors.As(err, &serviceBusyError):
+		return serviceBusyError.Backend == ""
+	default:
+		return errors.As(err, &serverError)
+	}
+}
+
+// coolDown pauses both the feeder and the worker for d.
+func (p *ProcessingController) coolDown(ctx context.Context, d time.Duration) {
+	select {
+	case p.cooldownChan <- d:
+	default:
+	}
+	p.wait(ctx, d)
+}
+
+// releaseOrder returns an order interrupted before accrual answered back to NEW,
+// so it does not look like accrual has started on it.
+func (p *ProcessingController) releaseOrder(o *models.Order) {
+	if o.Status != models.NEW {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if _, err := p.store.UpdateOrder(ctx, &models.Order{Number: o.Number, Status: models.NEW}); err != nil {
+		p.logger.Errorf("error releasing order %v: %v", o.Number, err)
+	}
 }
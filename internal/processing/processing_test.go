@@ -0,0 +1,328 @@
+package processing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rawen554/go-loyal/internal/adapters/accrual"
+	accrualMocks "github.com/rawen554/go-loyal/internal/adapters/accrual/mocks"
+	"github.com/rawen554/go-loyal/internal/adapters/store/mocks"
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("finishes order in flight", func(t *testing.T) {
+		store := mocks.NewMockStore(ctrl)
+		client := accrualMocks.NewMockAccrual(ctrl)
+		p := NewProcessingController(store, client, zap.L().Sugar())
+
+		started := make(chan struct{})
+		gomock.InOrder(
+			store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{Number: "1", Status: models.PROCESSING}).
+				Return(int64(1), nil),
+			client.EXPECT().GetOrderInfo(gomock.Any(), "1").
+				DoAndReturn(func(context.Context, string) (*accrual.AccrualOrderInfoShema, error) {
+					close(started)
+					time.Sleep(50 * time.Millisecond)
+					return &accrual.AccrualOrderInfoShema{Order: "1", Status: models.INVALID}, nil
+				}),
+			store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{Number: "1", Status: models.INVALID}).
+				Return(int64(1), nil),
+		)
+
+		p.ordersChan <- &models.Order{Number: "1", Status: models.NEW}
+		p.Process(context.Background())
+		<-started
+
+		require.NoError(t, p.Shutdown(context.Background()))
+	})
+
+	t.Run("releases interrupted and queued orders", func(t *testing.T) {
+		store := mocks.NewMockStore(ctrl)
+		client := accrualMocks.NewMockAccrual(ctrl)
+		p := NewProcessingController(store, client, zap.L().Sugar())
+
+		started := make(chan struct{})
+		gomock.InOrder(
+			store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{Number: "1", Status: models.PROCESSING}).
+				Return(int64(1), nil),
+			client.EXPECT().GetOrderInfo(gomock.Any(), "1").
+				DoAndReturn(func(ctx context.Context, _ string) (*accrual.AccrualOrderInfoShema, error) {
+					close(started)
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}),
+			store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{Number: "1", Status: models.NEW}).
+				Return(int64(1), nil),
+		)
+
+		p.ordersChan <- &models.Order{Number: "1", Status: models.NEW}
+		p.Process(context.Background())
+		<-started
+		p.ordersChan <- &models.Order{Number: "2", Status: models.NEW}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, p.Shutdown(ctx), context.DeadlineExceeded)
+		require.Empty(t, p.ordersChan)
+	})
+}
+
+func TestHandleAccrualError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	order := &models.Order{Number: "1", UserID: 1, Status: models.PROCESSING}
+
+	t.Run("rejected order is flagged for review", func(t *testing.T) {
+		store := mocks.NewMockStore(ctrl)
+		p := NewProcessingController(store, accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+
+		store.EXPECT().FlagOrderForReview(gomock.Any(), "1", models.ReviewAccrualRejected).Return(nil)
+
+		p.handleAccrualError(context.Background(), order, &accrual.ClientError{StatusCode: http.StatusBadRequest})
+	})
+
+	t.Run("client misconfiguration leaves order pending", func(t *testing.T) {
+		p := NewProcessingController(mocks.NewMockStore(ctrl), accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+
+		p.handleAccrualError(context.Background(), order, &accrual.ClientError{StatusCode: http.StatusUnauthorized})
+		p.handleAccrualError(context.Background(), order, &accrual.MalformedResponseError{StatusCode: http.StatusOK})
+	})
+
+	t.Run("server error cools down", func(t *testing.T) {
+		p := NewProcessingController(mocks.NewMockStore(ctrl), accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		p.handleAccrualError(ctx, order, &accrual.ServerError{StatusCode: http.StatusInternalServerError})
+		require.Equal(t, serverErrorCoolDown, <-p.cooldownChan)
+	})
+
+	t.Run("busy backend does not pause other backends", func(t *testing.T) {
+		p := NewProcessingController(mocks.NewMockStore(ctrl), accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+
+		p.handleAccrualError(context.Background(), order,
+			&accrual.ServiceBusyError{CoolDown: time.Minute, Backend: "eu", Err: accrual.ErrServiceBusy})
+		require.Empty(t, p.cooldownChan)
+	})
+
+	t.Run("open backend breaker does not pause other backends", func(t *testing.T) {
+		p := NewProcessingController(mocks.NewMockStore(ctrl), accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+
+		p.handleAccrualError(context.Background(), order,
+			&accrual.BreakerOpenError{Backend: "eu", Remaining: time.Minute})
+		require.Empty(t, p.cooldownChan)
+	})
+
+	t.Run("order without backend is flagged for review", func(t *testing.T) {
+		store := mocks.NewMockStore(ctrl)
+		p := NewProcessingController(store, accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+
+		store.EXPECT().FlagOrderForReview(gomock.Any(), "1", models.ReviewNoAccrualBackend).Return(nil)
+
+		p.handleAccrualError(context.Background(), order, accrual.ErrNoBackend)
+	})
+}
+
+func TestHandleUnknownOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2023, time.August, 1, 12, 0, 0, 0, time.UTC)
+	policy := UnknownOrderPolicy{Window: 24 * time.Hour, Backoff: time.Minute, MaxBackoff: 10 * time.Minute}
+
+	store := mocks.NewMockStore(ctrl)
+	p := NewProcessingController(store, accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar(),
+		WithUnknownOrderPolicy(policy))
+
+	gomock.InOrder(
+		store.EXPECT().DeferOrderLookup(gomock.Any(), "1", gomock.Any()).Return(nil),
+		store.EXPECT().DeferOrderLookup(gomock.Any(), "1", now.Add(time.Minute)).Return(nil),
+		store.EXPECT().DeferOrderLookup(gomock.Any(), "1", now.Add(4*time.Minute)).Return(nil),
+		store.EXPECT().DeferOrderLookup(gomock.Any(), "1", now.Add(10*time.Minute)).Return(nil),
+		store.EXPECT().FlagOrderForReview(gomock.Any(), "1", models.ReviewUnknownToAccrual).Return(nil),
+	)
+
+	fresh := &models.Order{Number: "1", UploadedAt: models.OrderTime(time.Now())}
+	p.handleAccrualError(context.Background(), fresh, accrual.ErrNoOrder)
+
+	uploaded := models.OrderTime(now.Add(-time.Hour))
+	for _, attempts := range []int{0, 2, 10} {
+		order := &models.Order{Number: "1", UploadedAt: uploaded, LookupAttempts: attempts}
+		p.handleUnknownOrder(context.Background(), order, now)
+	}
+
+	expired := &models.Order{Number: "1", UploadedAt: models.OrderTime(now.Add(-policy.Window))}
+	p.handleUnknownOrder(context.Background(), expired, now)
+}
+
+func TestUnknownOrderPolicyDelay(t *testing.T) {
+	unbounded := UnknownOrderPolicy{Backoff: 30 * time.Second}
+	require.Equal(t, 2*time.Minute, unbounded.delay(2))
+	for _, attempts := range []int{62, 100, 1000} {
+		require.Greater(t, unbounded.delay(attempts), unbounded.delay(10))
+	}
+
+	bounded := UnknownOrderPolicy{Backoff: 30 * time.Second, MaxBackoff: time.Hour}
+	require.Equal(t, time.Hour, bounded.delay(1000))
+}
+
+func TestPausesProcessing(t *testing.T) {
+	require.True(t, pausesProcessing(&accrual.ServerError{StatusCode: http.StatusBadGateway}))
+	require.True(t, pausesProcessing(&accrual.ServiceBusyError{CoolDown: time.Minute}))
+	require.True(t, pausesProcessing(&accrual.BreakerOpenError{Remaining: time.Minute}))
+	require.False(t, pausesProcessing(&accrual.ServiceBusyError{CoolDown: time.Minute, Backend: "eu"}))
+	require.False(t, pausesProcessing(&accrual.BreakerOpenError{Backend: "eu"}))
+	require.False(t, pausesProcessing(accrual.ErrNoBackend))
+	require.False(t, pausesProcessing(&accrual.ClientError{StatusCode: http.StatusBadRequest}))
+}
+
+func TestProcessBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("groups queued orders", func(t *testing.T) {
+		store := mocks.NewMockStore(ctrl)
+		client := accrualMocks.NewMockBatchAccrual(ctrl)
+		p := NewProcessingController(store, client, zap.L().Sugar(),
+			WithBatchSize(2),
+			WithUnknownOrderPolicy(UnknownOrderPolicy{Window: time.Hour, Backoff: time.Minute}),
+		)
+
+		store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{Number: "1", Status: models.PROCESSING}).
+			Return(int64(1), nil)
+		client.EXPECT().GetOrdersInfo(gomock.Any(), []string{"1", "2"}).
+			Return(map[string]*accrual.AccrualOrderInfoShema{
+				"2": {Order: "2", Status: models.INVALID},
+			}, nil)
+		store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{Number: "2", UserID: 2, Status: models.INVALID}).
+			Return(int64(1), nil)
+		store.EXPECT().DeferOrderLookup(gomock.Any(), "1", gomock.Any()).Return(nil)
+		client.EXPECT().GetOrderInfo(gomock.Any(), "3").
+			Return(&accrual.AccrualOrderInfoShema{Order: "3", Status: models.REGISTERED}, nil)
+
+		p.ordersChan <- &models.Order{Number: "2", UserID: 2, Status: models.REGISTERED}
+		p.ordersChan <- &models.Order{Number: "3", UserID: 3, Status: models.REGISTERED}
+		p.processOrders(context.Background(), &models.Order{
+			Number:     "1",
+			UserID:     1,
+			Status:     models.NEW,
+			UploadedAt: models.OrderTime(time.Now()),
+		})
+		p.processOrders(context.Background(), <-p.ordersChan)
+	})
+
+	t.Run("falls back to single lookups when batch is rejected", func(t *testing.T) {
+		store := mocks.NewMockStore(ctrl)
+		client := accrualMocks.NewMockBatchAccrual(ctrl)
+		p := NewProcessingController(store, client, zap.L().Sugar())
+
+		client.EXPECT().GetOrdersInfo(gomock.Any(), []string{"1", "2"}).
+			Return(nil, &accrual.ClientError{StatusCode: http.StatusBadRequest})
+		client.EXPECT().GetOrderInfo(gomock.Any(), "1").
+			Return(&accrual.AccrualOrderInfoShema{Order: "1", Status: models.PROCESSING}, nil)
+		client.EXPECT().GetOrderInfo(gomock.Any(), "2").
+			Return(nil, &accrual.ClientError{StatusCode: http.StatusBadRequest})
+		store.EXPECT().FlagOrderForReview(gomock.Any(), "2", models.ReviewAccrualRejected).Return(nil)
+
+		p.ordersChan <- &models.Order{Number: "2", UserID: 2, Status: models.PROCESSING}
+		p.processOrders(context.Background(), &models.Order{Number: "1", UserID: 1, Status: models.PROCESSING})
+	})
+
+	t.Run("handles orders the batch failed for", func(t *testing.T) {
+		store := mocks.NewMockStore(ctrl)
+		client := accrualMocks.NewMockBatchAccrual(ctrl)
+		p := NewProcessingController(store, client, zap.L().Sugar())
+
+		serverError := &accrual.ServerError{StatusCode: http.StatusBadGateway}
+		client.EXPECT().GetOrdersInfo(gomock.Any(), []string{"1", "2", "3", "4", "5"}).
+			Return(map[string]*accrual.AccrualOrderInfoShema{
+				"1": {Order: "1", Status: models.INVALID},
+			}, &accrual.BatchError{Errs: map[string]error{
+				"2": accrual.ErrNoBackend,
+				"3": &accrual.ClientError{StatusCode: http.StatusUnprocessableEntity},
+				"4": serverError,
+				"5": serverError,
+			}})
+		store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{Number: "1", UserID: 1, Status: models.INVALID}).
+			Return(int64(1), nil)
+		store.EXPECT().FlagOrderForReview(gomock.Any(), "2", models.ReviewNoAccrualBackend).Return(nil)
+		store.EXPECT().FlagOrderForReview(gomock.Any(), "3", models.ReviewAccrualRejected).Return(nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		orders := make([]*models.Order, 0, 5)
+		for i := 1; i <= 5; i++ {
+			orders = append(orders, &models.Order{Number: strconv.Itoa(i), UserID: uint64(i), Status: models.PROCESSING})
+		}
+		p.processBatch(ctx, client, orders)
+		require.Equal(t, serverErrorCoolDown, <-p.cooldownChan)
+	})
+
+}
+
+func TestApplyPreliminaryOrderInfo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStore(ctrl)
+	p := NewProcessingController(store, accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+	ctx := context.Background()
+
+	// The preliminary accrual is kept in the order to show up as pending, without the tier or a credit.
+	store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{
+		Number:  "1",
+		Accrual: 50,
+		Status:  models.PROCESSING,
+	}).Return(int64(1), nil)
+
+	order := &models.Order{Number: "1", UserID: 1, Status: models.REGISTERED}
+	info := &accrual.AccrualOrderInfoShema{Order: "1", Status: models.PROCESSING, Accrual: 50}
+	require.NoError(t, p.applyOrderInfo(ctx, order, info))
+
+	// Nothing changed since the last lookup.
+	order = &models.Order{Number: "1", UserID: 1, Status: models.PROCESSING, Accrual: 50}
+	require.NoError(t, p.applyOrderInfo(ctx, order, info))
+}
+
+func TestApplyOrderInfo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mocks.NewMockStore(ctrl)
+	p := NewProcessingController(store, accrualMocks.NewMockAccrual(ctrl), zap.L().Sugar())
+	ctx := context.Background()
+
+	gomock.InOrder(
+		store.EXPECT().GetOrder(gomock.Any(), "1").
+			Return(&models.Order{Number: "1", UserID: 1, Status: models.PROCESSING}, nil),
+		store.EXPECT().UpdateOrder(gomock.Any(), &models.Order{
+			Number:  "1",
+			UserID:  1,
+			Accrual: 500,
+			Status:  models.PROCESSED,
+		}).Return(int64(1), nil),
+		store.EXPECT().GetOrder(gomock.Any(), "1").
+			Return(&models.Order{Number: "1", UserID: 1, Status: models.PROCESSED, Accrual: 500}, nil),
+	)
+
+	require.NoError(t, p.ApplyOrderInfo(ctx, &accrual.AccrualOrderInfoShema{
+		Order: "1", Status: models.PROCESSED, Accrual: 500,
+	}))
+	// A redelivered result of a finished order changes nothing.
+	require.NoError(t, p.ApplyOrderInfo(ctx, &accrual.AccrualOrderInfoShema{
+		Order: "1", Status: models.PROCESSED, Accrual: 500,
+	}))
+	require.ErrorIs(t, p.ApplyOrderInfo(ctx, &accrual.AccrualOrderInfoShema{Order: "1", Status: "DONE"}),
+		ErrInvalidOrderInfo)
+}
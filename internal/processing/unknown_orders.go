@@ -0,0 +1,56 @@
+package processing
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+// UnknownOrderPolicy controls orders accrual answers 204 for. Lookups are retried with exponential
+// backoff from Backoff up to MaxBackoff, orders still unknown Window after upload are flagged for review.
+// Zero Window never flags, zero Backoff retries on every feed.
+type UnknownOrderPolicy struct {
+	Window     time.Duration
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func WithUnknownOrderPolicy(policy UnknownOrderPolicy) Option {
+	return func(p *ProcessingController) {
+		p.unknownOrders = policy
+	}
+}
+
+// delay returns the pause before the next lookup of an order already looked up attempts times.
+// Without MaxBackoff the doubling stops before the duration overflows.
+func (u UnknownOrderPolicy) delay(attempts int) time.Duration {
+	d := u.Backoff
+	for i := 0; i < attempts && (u.MaxBackoff <= 0 || d < u.MaxBackoff) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if u.MaxBackoff > 0 && d > u.MaxBackoff {
+		d = u.MaxBackoff
+	}
+	return d
+}
+
+func (p *ProcessingController) handleUnknownOrder(ctx context.Context, o *models.Order, now time.Time) {
+	policy := p.unknownOrders
+
+	if policy.Window > 0 && now.Sub(time.Time(o.UploadedAt)) >= policy.Window {
+		p.logger.Warnf("order %v is unknown to accrual for %v, flagging it for review", o.Number, policy.Window)
+		if err := p.store.FlagOrderForReview(ctx, o.Number, models.ReviewUnknownToAccrual); err != nil {
+			p.logger.Errorf("error flagging order for review: %v", err)
+		}
+		return
+	}
+
+	if policy.Backoff <= 0 {
+		return
+	}
+	if err := p.store.DeferOrderLookup(ctx, o.Number, now.Add(policy.delay(o.LookupAttempts))); err != nil {
+		p.logger.Errorf("error deferring order lookup: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package risk decides whether a withdrawal may go through before points leave the account.
+package risk
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+)
+
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	// Review parks the withdrawal until an admin approves it.
+	Review Decision = "review"
+	Deny   Decision = "deny"
+)
+
+const (
+	EvaluatorNone  = "none"
+	EvaluatorRules = "rules"
+)
+
+type Input struct {
+	At   time.Time
+	User *models.User
+	IP   string
+	// RecentLogins are the user's latest login events, newest first.
+	RecentLogins []models.AuditEvent
+	Amount       float64
+	AccountAge   time.Duration
+}
+
+type Evaluator interface {
+	Evaluate(in Input) (Decision, error)
+}
+
+func NewEvaluator(kind string, rules Rules) (Evaluator, error) {
+	switch kind {
+	case EvaluatorNone:
+		return AllowAll{}, nil
+	case EvaluatorRules:
+		return &rules, nil
+	default:
+		return nil, fmt.Errorf("unknown risk evaluator: %s", kind)
+	}
+}
+
+type AllowAll struct{}
+
+func (AllowAll) Evaluate(Input) (Decision, error) {
+	return Allow, nil
+}
+
+// Rules flags withdrawals from new accounts and from IPs the user has not logged in from before NewIPWindow.
+// Zero sums disable the corresponding decision.
+type Rules struct {
+	NewAccountAge time.Duration
+	NewIPWindow   time.Duration
+	ReviewSum     float64
+	DenySum       float64
+}
+
+func (r *Rules) Evaluate(in Input) (Decision, error) {
+	newAccount := in.AccountAge < r.NewAccountAge
+	newIP := !r.knownIP(in)
+
+	switch {
+	case newAccount && newIP && r.DenySum > 0 && in.Amount >= r.DenySum:
+		return Deny, nil
+	case (newAccount || newIP) && r.ReviewSum > 0 && in.Amount >= r.ReviewSum:
+		return Review, nil
+	default:
+		return Allow, nil
+	}
+}
+
+// knownIP reports whether the user logged in from the IP before the new IP window.
+func (r *Rules) knownIP(in Input) bool {
+	threshold := in.At.Add(-r.NewIPWindow)
+	for _, e := range in.RecentLogins {
+		if e.IP == in.IP && e.CreatedAt.Before(threshold) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package risk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rawen554/go-loyal/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesEvaluate(t *testing.T) {
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	rules := &Rules{
+		NewAccountAge: 7 * 24 * time.Hour,
+		NewIPWindow:   24 * time.Hour,
+		ReviewSum:     500,
+		DenySum:       5000,
+	}
+	logins := []models.AuditEvent{
+		{IP: "10.0.0.2", CreatedAt: now.Add(-time.Hour)},
+		{IP: "10.0.0.1", CreatedAt: now.Add(-30 * 24 * time.Hour)},
+	}
+
+	tests := []struct {
+		name  string
+		input Input
+		want  Decision
+	}{
+		{
+			name:  "known ip, old account",
+			input: Input{At: now, IP: "10.0.0.1", RecentLogins: logins, Amount: 1000, AccountAge: 90 * 24 * time.Hour},
+			want:  Allow,
+		},
+		{
+			name:  "ip first seen an hour ago",
+			input: Input{At: now, IP: "10.0.0.2", RecentLogins: logins, Amount: 1000, AccountAge: 90 * 24 * time.Hour},
+			want:  Review,
+		},
+		{
+			name:  "new ip, small amount",
+			input: Input{At: now, IP: "10.0.0.2", RecentLogins: logins, Amount: 100, AccountAge: 90 * 24 * time.Hour},
+			want:  Allow,
+		},
+		{
+			name:  "new account and new ip, large amount",
+			input: Input{At: now, IP: "10.0.0.3", Amount: 5000, AccountAge: time.Hour},
+			want:  Deny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := rules.Evaluate(tt.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, decision)
+		})
+	}
+}
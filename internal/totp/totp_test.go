@@ -0,0 +1,51 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from RFC 6238, appendix B (SHA1, last six digits).
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		code string
+		unix int64
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, tt.code, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	previous, err := Code(secret, Step(now)-1)
+	require.NoError(t, err)
+
+	step, ok, err := Validate(secret, previous, now, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Step(now)-1, step)
+
+	_, ok, err = Validate(secret, previous, now, 0)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, err = Validate("not base32!", previous, now, 1)
+	require.ErrorIs(t, err, ErrInvalidSecret)
+}
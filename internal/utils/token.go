@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const referralCodeSize = 5
+
+func GenerateToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error reading random bytes: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GenerateReferralCode returns a short code that is easy to type.
+func GenerateReferralCode() (string, error) {
+	b := make([]byte, referralCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error reading random bytes: %w", err)
+	}
+
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}